@@ -0,0 +1,120 @@
+package bot
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	apiRateLimit       = 20
+	apiRateLimitWindow = time.Minute
+)
+
+type apiToken struct {
+	Name      string   `json:"name"`
+	TokenHash string   `json:"token_hash"`
+	Rooms     []string `json:"rooms"`
+}
+
+type apiRateWindow struct {
+	start time.Time
+	count int
+}
+
+var apiRateLimiter = struct {
+	sync.Mutex
+	windows map[string]*apiRateWindow
+}{windows: make(map[string]*apiRateWindow)}
+
+func getAPITokens() []apiToken {
+	tokensJson := db.Get("api_tokens")
+	var tokens []apiToken
+	if tokensJson != "" {
+		json.Unmarshal([]byte(tokensJson), &tokens)
+	}
+	return tokens
+}
+
+func saveAPITokens(tokens []apiToken) {
+	res, err := json.Marshal(tokens)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	db.Set("api_tokens", string(res))
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newAPIToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (t apiToken) allowsRoom(roomID string) bool {
+	for _, r := range t.Rooms {
+		if r == roomID {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticateAPIRequest returns the API token matching the bearer token of the request, if any
+func authenticateAPIRequest(req *http.Request) (apiToken, bool) {
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return apiToken{}, false
+	}
+	hash := hashAPIToken(strings.TrimPrefix(auth, "Bearer "))
+	for _, t := range getAPITokens() {
+		if t.TokenHash == hash {
+			return t, true
+		}
+	}
+	return apiToken{}, false
+}
+
+// allowAPIRequest counts a request towards the rate limit of the given token and reports whether it is allowed
+func allowAPIRequest(tokenName string) bool {
+	apiRateLimiter.Lock()
+	defer apiRateLimiter.Unlock()
+	now := time.Now()
+	w, ok := apiRateLimiter.windows[tokenName]
+	if !ok || now.Sub(w.start) >= apiRateLimitWindow {
+		w = &apiRateWindow{now, 0}
+		apiRateLimiter.windows[tokenName] = w
+	}
+	if w.count >= apiRateLimit {
+		return false
+	}
+	w.count++
+	return true
+}
+
+func writeAPIResponse(w http.ResponseWriter, status int, resp interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Print(err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, msg string) {
+	writeAPIResponse(w, status, struct {
+		Error string `json:"error"`
+	}{msg})
+}
@@ -0,0 +1,276 @@
+package bot
+
+import (
+	"encoding/json"
+	"html"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type alertmanagerPayload struct {
+	Version           string              `json:"version"`
+	GroupKey          string              `json:"groupKey"`
+	TruncatedAlerts   int                 `json:"truncatedAlerts"`
+	Status            string              `json:"status"`
+	Receiver          string              `json:"receiver"`
+	GroupLabels       map[string]string   `json:"groupLabels"`
+	CommonLabels      map[string]string   `json:"commonLabels"`
+	CommonAnnotations map[string]string   `json:"commonAnnotations"`
+	ExternalURL       string              `json:"externalURL"`
+	Alerts            []alertmanagerAlert `json:"alerts"`
+}
+
+type alertmanagerAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+type alertGroup struct {
+	name     string
+	severity string
+	alerts   []alertmanagerAlert
+}
+
+// alertmanagerEventsLock guards the read-modify-write of the stored firing message event IDs
+var alertmanagerEventsLock sync.Mutex
+
+// alertmanagerEventRetention is how long the event ID of a firing message is kept for editing it when the group
+// resolves. Alertmanager repeats firing notifications, which refreshes the entry, so only groups that are no longer
+// sent at all expire
+const alertmanagerEventRetention = 7 * 24 * time.Hour
+
+type alertmanagerEvent struct {
+	EventID string `json:"event_id"`
+	Time    int64  `json:"time"`
+}
+
+func getAlertmanagerEvents() map[string]alertmanagerEvent {
+	eventsJson := db.Get("alertmanager_events")
+	var events map[string]alertmanagerEvent
+	if eventsJson != "" {
+		if err := json.Unmarshal([]byte(eventsJson), &events); err != nil {
+			// entries stored before the send time was tracked are plain event IDs
+			var eventIDs map[string]string
+			json.Unmarshal([]byte(eventsJson), &eventIDs)
+			events = make(map[string]alertmanagerEvent)
+			for key, eventID := range eventIDs {
+				events[key] = alertmanagerEvent{eventID, time.Now().Unix()}
+			}
+		}
+	}
+	if events == nil {
+		events = make(map[string]alertmanagerEvent)
+	}
+	return events
+}
+
+// saveAlertmanagerEvents stores the events, dropping the ones older than alertmanagerEventRetention
+func saveAlertmanagerEvents(events map[string]alertmanagerEvent) {
+	cutoff := time.Now().Add(-alertmanagerEventRetention).Unix()
+	for key, event := range events {
+		if event.Time < cutoff {
+			delete(events, key)
+		}
+	}
+	res, err := json.Marshal(events)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	db.Set("alertmanager_events", string(res))
+}
+
+func alertSeverityStyle(severity, status string) (emoji, color string) {
+	if status == "resolved" {
+		return "✅", "#009300"
+	}
+	switch strings.ToLower(severity) {
+	case "critical", "error", "page":
+		return "🔴", "#FF0000"
+	case "warning", "warn":
+		return "🟠", "#FF8C00"
+	case "info", "none":
+		return "🔵", "#0000FC"
+	default:
+		return "⚪", "#555555"
+	}
+}
+
+// groupAlerts deduplicates the alerts by fingerprint and groups them by alertname and severity
+func groupAlerts(alerts []alertmanagerAlert) []alertGroup {
+	seen := make(map[string]bool)
+	groups := make(map[string]*alertGroup)
+	var keys []string
+	for _, a := range alerts {
+		id := a.Fingerprint
+		if id == "" {
+			id = formatAlertLabels(a.Labels)
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		key := a.Labels["alertname"] + "\x00" + a.Labels["severity"]
+		g, ok := groups[key]
+		if !ok {
+			g = &alertGroup{name: a.Labels["alertname"], severity: a.Labels["severity"]}
+			groups[key] = g
+			keys = append(keys, key)
+		}
+		g.alerts = append(g.alerts, a)
+	}
+	sort.Strings(keys)
+	var res []alertGroup
+	for _, k := range keys {
+		res = append(res, *groups[k])
+	}
+	return res
+}
+
+func formatAlertLabels(labels map[string]string) string {
+	var parts []string
+	for k, v := range labels {
+		if k == "alertname" || k == "severity" {
+			continue
+		}
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+func formatAlertmanagerPayload(payload alertmanagerPayload) string {
+	loc, _ := time.LoadLocation(timezone)
+	var output []string
+	for _, g := range groupAlerts(payload.Alerts) {
+		status := payload.Status
+		for _, a := range g.alerts {
+			if a.Status == "firing" {
+				status = "firing"
+			}
+		}
+		emoji, color := alertSeverityStyle(g.severity, status)
+		name := g.name
+		if name == "" {
+			name = "alert"
+		}
+		header := emoji + " <font color=\"" + color + "\"><b>[" + strings.ToUpper(status) + ":" + strconv.Itoa(len(g.alerts)) + "]</b></font> <b>" + html.EscapeString(name) + "</b>"
+		if g.severity != "" {
+			header += " (" + html.EscapeString(g.severity) + ")"
+		}
+		var items []string
+		for _, a := range g.alerts {
+			summary := a.Annotations["summary"]
+			if summary == "" {
+				summary = a.Annotations["description"]
+			}
+			item := html.EscapeString(formatAlertLabels(a.Labels))
+			if summary != "" {
+				item = html.EscapeString(summary) + " <font color=\"gray\">" + item + "</font>"
+			}
+			if a.Status == "resolved" && !a.EndsAt.IsZero() {
+				item += " — resolved at " + a.EndsAt.In(loc).Format("15:04:05 on 2.1.2006")
+			} else if !a.StartsAt.IsZero() {
+				item += " — since " + a.StartsAt.In(loc).Format("15:04:05 on 2.1.2006")
+			}
+			if a.GeneratorURL != "" {
+				item += " (<a href=\"" + html.EscapeString(a.GeneratorURL) + "\">source</a>)"
+			}
+			items = append(items, "<li>"+item+"</li>")
+		}
+		output = append(output, header+"<ul>"+strings.Join(items, "")+"</ul>")
+	}
+	if payload.TruncatedAlerts > 0 {
+		output = append(output, "<i>"+strconv.Itoa(payload.TruncatedAlerts)+" more alerts were truncated</i>")
+	}
+	return strings.Join(output, "")
+}
+
+// postAlertmanagerNotification sends a notification for firing alerts, and edits the earlier firing message of the same
+// alert group to the resolved state when the group resolves
+func postAlertmanagerNotification(roomID string, payload alertmanagerPayload) {
+	msg := formatAlertmanagerPayload(payload)
+	if msg == "" {
+		return
+	}
+	key := roomID + "|" + payload.GroupKey
+
+	if payload.Status == "resolved" {
+		alertmanagerEventsLock.Lock()
+		events := getAlertmanagerEvents()
+		event, ok := events[key]
+		if ok {
+			delete(events, key)
+			saveAlertmanagerEvents(events)
+		}
+		alertmanagerEventsLock.Unlock()
+		if ok {
+			client.EditFormattedNotice(roomID, event.EventID, msg)
+		} else {
+			client.SendFormattedNotice(roomID, msg)
+		}
+		return
+	}
+	// wait for the send without holding the lock so a slow send doesn't hold up other notifications
+	done := client.SendFormattedNotice(roomID, msg)
+	select {
+	case eventID := <-done:
+		if eventID != "" {
+			alertmanagerEventsLock.Lock()
+			events := getAlertmanagerEvents()
+			events[key] = alertmanagerEvent{eventID, time.Now().Unix()}
+			saveAlertmanagerEvents(events)
+			alertmanagerEventsLock.Unlock()
+		}
+	case <-time.After(30 * time.Second):
+		log.Print("Timed out waiting for alertmanager notification to be sent to room " + roomID)
+	}
+}
+
+func alertmanagerHandler(w http.ResponseWriter, req *http.Request) {
+	metrics.webhooksHandled.With(prometheus.Labels{"hook": "alertmanager"}).Inc()
+	if req.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	roomID := strings.TrimPrefix(req.URL.Path, "/api/alertmanager/")
+	if roomID == "" || strings.Contains(roomID, "/") {
+		writeAPIError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	token, ok := authenticateAPIRequest(req)
+	if !ok {
+		writeAPIError(w, http.StatusUnauthorized, "invalid or missing token")
+		return
+	}
+	if !token.allowsRoom(roomID) {
+		writeAPIError(w, http.StatusForbidden, "token is not authorized for room "+roomID)
+		return
+	}
+	if !allowAPIRequest(token.Name) {
+		w.Header().Set("Retry-After", "60")
+		writeAPIError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		return
+	}
+
+	var payload alertmanagerPayload
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	go postAlertmanagerNotification(roomID, payload)
+	writeAPIResponse(w, http.StatusOK, struct{}{})
+}
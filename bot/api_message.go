@@ -0,0 +1,114 @@
+package bot
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type apiMessageRequest struct {
+	Body    string `json:"body"`
+	Format  string `json:"format"`
+	MsgType string `json:"msgtype"`
+}
+
+// sendAPIMessage sends the message through the outbound queue and waits for the resulting event ID. Returns false as
+// pending if the send failed, and true as pending without an event ID if the message is still queued after the wait
+func sendAPIMessage(roomID string, msg apiMessageRequest) (eventID string, pending bool) {
+	var done <-chan string
+	notice := msg.MsgType != "m.text"
+	switch {
+	case msg.Format == "markdown" && notice:
+		done = client.SendMarkdownNotice(roomID, msg.Body)
+	case msg.Format == "markdown":
+		done = client.SendMarkdownMessage(roomID, msg.Body)
+	case msg.Format == "html" && notice:
+		done = client.SendFormattedNotice(roomID, msg.Body)
+	case msg.Format == "html":
+		done = client.SendFormattedMessage(roomID, msg.Body)
+	case notice:
+		done = client.SendNotice(roomID, msg.Body)
+	default:
+		done = client.SendMessage(roomID, msg.Body)
+	}
+	select {
+	case eventID = <-done:
+		return eventID, false
+	case <-time.After(30 * time.Second):
+		return "", true
+	}
+}
+
+func apiMessageHandler(w http.ResponseWriter, req *http.Request) {
+	metrics.webhooksHandled.With(prometheus.Labels{"hook": "message"}).Inc()
+	if req.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/api/rooms/")
+	if !strings.HasSuffix(path, "/message") {
+		writeAPIError(w, http.StatusNotFound, "not found")
+		return
+	}
+	roomID := strings.TrimSuffix(path, "/message")
+	if roomID == "" || strings.Contains(roomID, "/") {
+		writeAPIError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	token, ok := authenticateAPIRequest(req)
+	if !ok {
+		writeAPIError(w, http.StatusUnauthorized, "invalid or missing token")
+		return
+	}
+	if !token.allowsRoom(roomID) {
+		writeAPIError(w, http.StatusForbidden, "token is not authorized for room "+roomID)
+		return
+	}
+	if !allowAPIRequest(token.Name) {
+		w.Header().Set("Retry-After", "60")
+		writeAPIError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		return
+	}
+
+	var msg apiMessageRequest
+	if err := json.NewDecoder(req.Body).Decode(&msg); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if msg.Body == "" {
+		writeAPIError(w, http.StatusBadRequest, "body is required")
+		return
+	}
+	switch msg.Format {
+	case "", "plain", "html", "markdown":
+	default:
+		writeAPIError(w, http.StatusBadRequest, "format must be one of plain, html or markdown")
+		return
+	}
+	switch msg.MsgType {
+	case "", "m.notice", "m.text":
+	default:
+		writeAPIError(w, http.StatusBadRequest, "msgtype must be m.notice or m.text")
+		return
+	}
+
+	eventID, pending := sendAPIMessage(roomID, msg)
+	if pending {
+		// the message is still queued and will be sent later, so a client retrying on an error would send it twice
+		writeAPIResponse(w, http.StatusAccepted, struct {
+			Status string `json:"status"`
+		}{"queued"})
+		return
+	}
+	if eventID == "" {
+		writeAPIError(w, http.StatusBadGateway, "failed to send the message")
+		return
+	}
+	writeAPIResponse(w, http.StatusOK, struct {
+		EventID string `json:"event_id"`
+	}{eventID})
+}
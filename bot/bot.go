@@ -27,24 +27,14 @@ func handleTextEvent(event *gomatrix.Event) {
 		msg := event.Content["body"].(string)
 		format, _ := event.Content["format"].(string)
 		formattedBody, _ := event.Content["formatted_body"].(string)
-		msgCommand := strings.Split(msg, " ")[0]
-		isCommand := true
-		switch msgCommand {
-		case "!ping":
-			ping(event.RoomID, msg)
-		case "!traceroute":
-			traceroute(event.RoomID, msg)
-		case "!ruuvi":
-			ruuvi(event.RoomID, event.Sender, msg)
-		case "!grafana":
-			grafana(event.RoomID, event.Sender, msg)
-		case "!remind":
-			remind(event.RoomID, event.Sender, msg, format, formattedBody)
-		default:
-			isCommand = false
+		replyTo := matrix.GetReplyEventID(event)
+		if replyTo != "" {
+			msg = matrix.StripReplyFallback(msg)
+			formattedBody = matrix.StripFormattedReplyFallback(formattedBody)
 		}
-		if isCommand {
-			metrics.commandsHandled.With(prometheus.Labels{"command": msgCommand}).Inc()
+		msgCommand := strings.Split(msg, " ")[0]
+		if c, ok := commands[msgCommand]; ok {
+			c.handler(commandContext{event.RoomID, event.Sender, msg, format, formattedBody, replyTo})
 		}
 	}
 }
@@ -59,18 +49,24 @@ func handleMemberEvent(event *gomatrix.Event) {
 
 func Run(homeserverURL, userID, accessToken, hookSecret, dataPath, admin string) error {
 	initMetrics()
+	initCommands()
 	db = siikadb.NewDB(dataPath + "/siikabot.db")
 	client = matrix.NewClient(homeserverURL, userID, accessToken)
 	adminUser = admin
+	initRoomSettings()
 
 	client.OnEvent("m.room.member", handleMemberEvent)
 	client.OnEvent("m.room.message", handleTextEvent)
+	client.OnEvent("m.reaction", handleReactionEvent)
+	client.OnEvent("m.room.redaction", handleRedactionEvent)
 	resp := client.InitialSync()
 	for roomID := range resp.Rooms.Invite {
 		client.JoinRoom(roomID)
 		log.Print("Joined room " + roomID)
 	}
+	registerJob("outbound event processor", outboundQueueStatus)
 	initReminder()
+	initRuuviAlerts()
 	initHTTP(hookSecret)
 	return client.Sync()
 }
@@ -0,0 +1,69 @@
+package bot
+
+import (
+	"strings"
+)
+
+func formatAPITokens(tokens []apiToken) string {
+	respLines := []string{"Current API tokens: "}
+	for _, t := range tokens {
+		respLines = append(respLines, t.Name+": "+strings.Join(t.Rooms, " "))
+	}
+	return strings.Join(respLines, "\n")
+}
+
+func apitoken(roomID, msg string) {
+	params := strings.Split(msg, " ")
+	if len(params) == 1 {
+		client.SendMessage(roomID, "Usage: !apitoken [create/revoke/list] <...>")
+		return
+	}
+	switch params[1] {
+	case "list":
+		client.SendMessage(roomID, formatAPITokens(getAPITokens()))
+	case "create":
+		if len(params) < 3 {
+			client.SendMessage(roomID, "Usage: !apitoken create <name> [room-id ...]")
+			return
+		}
+		// the token is posted in the room and stays in its history, so don't post it where others can read it
+		if !client.IsDirectRoom(roomID, adminUser) {
+			client.SendMessage(roomID, "Tokens can only be created in a direct message room with the bot")
+			return
+		}
+		tokens := getAPITokens()
+		for _, t := range tokens {
+			if t.Name == params[2] {
+				client.SendMessage(roomID, "Token "+params[2]+" already exists")
+				return
+			}
+		}
+		rooms := params[3:]
+		if len(rooms) == 0 {
+			rooms = []string{roomID}
+		}
+		token, err := newAPIToken()
+		if err != nil {
+			client.SendMessage(roomID, err.Error())
+			return
+		}
+		saveAPITokens(append(tokens, apiToken{params[2], hashAPIToken(token), rooms}))
+		client.SendMessage(roomID, "Created token "+params[2]+" for rooms "+strings.Join(rooms, " ")+
+			"\nThe token will not be shown again: "+token)
+	case "revoke":
+		if len(params) < 3 {
+			client.SendMessage(roomID, "Usage: !apitoken revoke <name>")
+			return
+		}
+		var newTokens []apiToken
+		for _, t := range getAPITokens() {
+			if t.Name != params[2] {
+				newTokens = append(newTokens, t)
+			}
+		}
+		saveAPITokens(newTokens)
+		client.SendMessage(roomID, formatAPITokens(newTokens))
+	default:
+		client.SendMessage(roomID, "Usage: !apitoken [create/revoke/list] <...>")
+	}
+}
@@ -0,0 +1,101 @@
+package bot
+
+import (
+	"strings"
+)
+
+type roomSettingDef struct {
+	name        string
+	description string
+	get         func(roomID string) string
+	set         func(roomID, value string) error
+}
+
+// roomSettingDefs are the room settings exposed through !config, stored in the room settings under the same names
+var roomSettingDefs = []roomSettingDef{
+	{"quiet_hours", "window during which reminders are held back, for example 22:00-07:00",
+		func(roomID string) string {
+			if q, ok := getRoomQuietHours(roomID); ok {
+				return q.String()
+			}
+			return "off"
+		},
+		func(roomID, value string) error {
+			q, err := parseQuietHours(value)
+			if err == nil {
+				setRoomSetting(roomID, "quiet_hours", q)
+			}
+			return err
+		}},
+	{"streaming", "update interval and duration of live updating messages, for example 10s 10m",
+		func(roomID string) string {
+			return getRoomStreamingSettings(roomID).String()
+		},
+		func(roomID, value string) error {
+			s, err := parseStreamingSettings(roomID, strings.Fields(value))
+			if err == nil {
+				setRoomSetting(roomID, "streaming", s)
+			}
+			return err
+		}},
+	{"location", "latitude and longitude used for sunrise and sunset reminders",
+		func(roomID string) string {
+			return getRoomLocation(roomID).String()
+		},
+		func(roomID, value string) error {
+			loc, err := parseLocation(value)
+			if err == nil {
+				setRoomSetting(roomID, "location", loc)
+			}
+			return err
+		}},
+}
+
+func findRoomSettingDef(name string) (roomSettingDef, bool) {
+	for _, d := range roomSettingDefs {
+		if d.name == name {
+			return d, true
+		}
+	}
+	return roomSettingDef{}, false
+}
+
+func config(roomID, msg string) {
+	params := strings.SplitN(msg, " ", 4)
+	if len(params) == 1 {
+		var lines []string
+		for _, d := range roomSettingDefs {
+			lines = append(lines, "<li><b>"+d.name+"</b> = "+d.get(roomID)+" <font color=\"gray\">("+d.description+")</font></li>")
+		}
+		client.SendFormattedMessage(roomID, "Settings of this room:<ul>"+strings.Join(lines, "")+"</ul>")
+		return
+	}
+	if len(params) < 3 {
+		client.SendMessage(roomID, "Usage: !config [get/set/unset] <setting> [value]")
+		return
+	}
+	d, ok := findRoomSettingDef(params[2])
+	if !ok {
+		client.SendMessage(roomID, "Unknown setting: "+params[2])
+		return
+	}
+	switch params[1] {
+	case "get":
+		client.SendMessage(roomID, d.name+" = "+d.get(roomID))
+	case "set":
+		if len(params) < 4 {
+			client.SendMessage(roomID, "Usage: !config set "+d.name+" <value>")
+			return
+		}
+		if err := d.set(roomID, params[3]); err != nil {
+			client.SendMessage(roomID, err.Error())
+			return
+		}
+		client.SendMessage(roomID, d.name+" = "+d.get(roomID))
+	case "unset":
+		deleteRoomSetting(roomID, d.name)
+		client.SendMessage(roomID, d.name+" = "+d.get(roomID))
+	default:
+		client.SendMessage(roomID, "Usage: !config [get/set/unset] <setting> [value]")
+	}
+}
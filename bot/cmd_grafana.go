@@ -4,11 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"log"
-	"net/http"
-	"strconv"
+	"net/url"
 	"strings"
 	"text/template"
-	"time"
+
+	siikagrafana "github.com/Scrin/siikabot/grafana"
 )
 
 type grafanaConfig struct {
@@ -16,14 +16,6 @@ type grafanaConfig struct {
 	Sources  map[string]string `json:"sources"`
 }
 
-type grafanaResponse struct {
-	Results []struct {
-		Series []struct {
-			Values [][]interface{} `json:"values"`
-		} `json:"series"`
-	} `json:"results"`
-}
-
 func getGrafanaConfigs() map[string]grafanaConfig {
 	endpointsJson := db.Get("grafana_configs")
 	var configs map[string]grafanaConfig
@@ -85,7 +77,8 @@ func grafana(roomID, sender, msg string) {
 			"<b>!grafana remove &lt;template-name></b> removes a template config<br>"+
 			"<b>!grafana rename &lt;template-name></b> renames a template config<br>"+
 			"<b>!grafana set template &lt;template-name> &lt;templatestring></b> sets the template string for a template config<br>"+
-			"<b>!grafana set datasource &lt;template-name> &lt;datasource-name> &lt;datasource-url></b> sets a datasource for a template config. <b>-</b> as url will remove the datasource")
+			"<b>!grafana set datasource &lt;template-name> &lt;datasource-name> &lt;datasource-url></b> sets a datasource for a template config. <b>-</b> as url will remove the datasource<br>"+
+			"<b>!grafana render &lt;template-name> &lt;panel-url></b> posts an image of a dashboard panel on the same Grafana as one of the template's datasources")
 	case "config":
 		if len(params) == 3 {
 			configs := getGrafanaConfigs()
@@ -99,8 +92,7 @@ func grafana(roomID, sender, msg string) {
 			client.SendMessage(roomID, formatGrafanaConfigs(getGrafanaConfigs()))
 		}
 	case "add":
-		if !validUser(sender) {
-			client.SendMessage(roomID, "Only authorized users can use this command")
+		if !checkPermission(roomID, sender, "grafana") {
 			return
 		}
 		if len(params) < 3 {
@@ -112,8 +104,7 @@ func grafana(roomID, sender, msg string) {
 		saveGrafanaConfigs(configs)
 		client.SendMessage(roomID, formatGrafanaConfigs(configs))
 	case "remove":
-		if !validUser(sender) {
-			client.SendMessage(roomID, "Only authorized users can use this command")
+		if !checkPermission(roomID, sender, "grafana") {
 			return
 		}
 		if len(params) < 3 {
@@ -125,8 +116,7 @@ func grafana(roomID, sender, msg string) {
 		saveGrafanaConfigs(configs)
 		client.SendMessage(roomID, formatGrafanaConfigs(configs))
 	case "rename":
-		if !validUser(sender) {
-			client.SendMessage(roomID, "Only authorized users can use this command")
+		if !checkPermission(roomID, sender, "grafana") {
 			return
 		}
 		if len(params) < 4 {
@@ -144,8 +134,7 @@ func grafana(roomID, sender, msg string) {
 		saveGrafanaConfigs(configs)
 		client.SendMessage(roomID, formatGrafanaConfigs(configs))
 	case "set":
-		if !validUser(sender) {
-			client.SendMessage(roomID, "Only authorized users can use this command")
+		if !checkPermission(roomID, sender, "grafana") {
 			return
 		}
 		if len(params) < 4 {
@@ -187,9 +176,24 @@ func grafana(roomID, sender, msg string) {
 		default:
 			client.SendMessage(roomID, "Usage: !grafana set [template/datasource]")
 		}
+	case "render":
+		// the panel is fetched with the credentials of the datasource, so any dashboard on that Grafana can be rendered
+		if !checkPermission(roomID, sender, "grafana") {
+			return
+		}
+		if len(params) < 4 {
+			client.SendMessage(roomID, "Usage: !grafana render <template-name> <panel-url>")
+			return
+		}
+		configs := getGrafanaConfigs()
+		config, ok := configs[params[2]]
+		if !ok {
+			client.SendMessage(roomID, "Template "+params[2]+" not found.")
+			return
+		}
+		go renderGrafanaPanel(roomID, config, params[3])
 	case "authorize":
-		if sender != adminUser {
-			client.SendMessage(roomID, "Only admins can use this command")
+		if !checkPermission(roomID, sender, "admin") {
 			return
 		}
 		if len(params) < 3 {
@@ -210,7 +214,7 @@ func grafana(roomID, sender, msg string) {
 				return
 			}
 			client.SendFormattedMessage(roomID, formatTemplate(config))
-		case 3:
+		case 3, 4, 5:
 			configs := getGrafanaConfigs()
 			config, ok := configs[params[1]]
 			if !ok {
@@ -221,21 +225,14 @@ func grafana(roomID, sender, msg string) {
 				client.SendMessage(roomID, "Unknown argument: "+params[2])
 				return
 			}
-			go func() {
-				start := time.Now().Unix()
-				outChan, done := client.SendStreamingFormattedNotice(roomID)
-				for {
-					outChan <- formatTemplate(config) + "<br><font color=\"gray\">[last updated at " + time.Now().Format("15:04:05") + "]</font>"
-					time.Sleep(10 * time.Second)
-					if start+600 < time.Now().Unix() {
-						break
-					}
-				}
-				outChan <- formatTemplate(config)
-				close(done)
-			}()
+			settings, err := parseStreamingSettings(roomID, params[3:])
+			if err != nil {
+				client.SendMessage(roomID, "Usage: !grafana <template-name> - [interval] [duration]: "+err.Error())
+				return
+			}
+			streamFormattedNotice(roomID, settings, func() string { return formatTemplate(config) })
 		default:
-			client.SendMessage(roomID, "Usage: !grafana <template-name>")
+			client.SendMessage(roomID, "Usage: !grafana <template-name> [- [interval] [duration]]")
 		}
 	}
 }
@@ -272,21 +269,47 @@ func formatTemplate(config grafanaConfig) string {
 	return buf.String()
 }
 
-func queryGrafana(queryURL string) string {
-	resp, err := http.Get(queryURL)
+// renderGrafanaPanel posts an image of a dashboard panel. The panel must be on the same Grafana instance as one of the
+// datasources of the template, and the credentials of that datasource URL are used for rendering
+func renderGrafanaPanel(roomID string, config grafanaConfig, panelURL string) {
+	panel, err := url.Parse(panelURL)
 	if err != nil {
-		return err.Error()
+		client.SendMessage(roomID, "Invalid panel URL: "+err.Error())
+		return
 	}
-	var grafanaResp grafanaResponse
-	if err = json.NewDecoder(resp.Body).Decode(&grafanaResp); err != nil {
-		return err.Error()
-	} else if len(grafanaResp.Results) < 1 || len(grafanaResp.Results[0].Series) < 1 {
-		return "N/A"
+	var source *url.URL
+	for _, v := range config.Sources {
+		if u, err := url.Parse(v); err == nil && u.Scheme == panel.Scheme && u.Host == panel.Host {
+			source = u
+			break
+		}
+	}
+	if source == nil {
+		client.SendMessage(roomID, "The panel must be on the same Grafana as one of the template's datasources")
+		return
+	}
+	panel.User = source.User
+	renderURL, err := siikagrafana.RenderURL(panel.String(), 1000, 500)
+	if err != nil {
+		client.SendMessage(roomID, err.Error())
+		return
 	}
+	img, err := siikagrafana.Render(renderURL)
+	if err != nil {
+		client.SendMessage(roomID, err.Error())
+		return
+	}
+	if _, err := client.SendImage(roomID, "Grafana panel", img); err != nil {
+		client.SendMessage(roomID, "Failed to upload panel image: "+err.Error())
+	}
+}
 
-	if floatValue, ok := grafanaResp.Results[0].Series[0].Values[0][1].(float64); ok {
-		return strconv.FormatFloat(floatValue, 'f', 2, 64)
-	} else {
-		return grafanaResp.Results[0].Series[0].Values[0][1].(string)
+func queryGrafana(queryURL string) string {
+	resp, err := siikagrafana.Query(queryURL)
+	if err == siikagrafana.ErrNoData {
+		return "N/A"
+	} else if err != nil {
+		return err.Error()
 	}
+	return resp.FormattedFirstValue()
 }
@@ -0,0 +1,52 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type backgroundJob struct {
+	name   string
+	status func() string
+}
+
+var backgroundJobs struct {
+	sync.Mutex
+	jobs []backgroundJob
+}
+
+// registerJob adds a background job to the !jobs listing, status should return a short single line description of its state
+func registerJob(name string, status func() string) {
+	backgroundJobs.Lock()
+	defer backgroundJobs.Unlock()
+	backgroundJobs.jobs = append(backgroundJobs.jobs, backgroundJob{name, status})
+}
+
+func formatJobTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	loc, _ := time.LoadLocation(timezone)
+	return t.In(loc).Format("15:04:05 on 2.1.2006")
+}
+
+func outboundQueueStatus() string {
+	length, capacity := client.OutboundQueueLength()
+	status := strconv.Itoa(length) + "/" + strconv.Itoa(capacity) + " events queued"
+	if length*10 >= capacity*8 {
+		status = "<font color=\"#FF0000\">" + status + ", backpressure</font>"
+	}
+	return status
+}
+
+func jobs(roomID string) {
+	backgroundJobs.Lock()
+	var lines []string
+	for _, j := range backgroundJobs.jobs {
+		lines = append(lines, "<li><b>"+j.name+"</b>: "+j.status()+"</li>")
+	}
+	backgroundJobs.Unlock()
+	client.SendFormattedMessage(roomID, "Background jobs:<ul>"+strings.Join(lines, "")+"</ul>")
+}
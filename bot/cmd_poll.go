@@ -0,0 +1,251 @@
+package bot
+
+import (
+	"encoding/json"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Scrin/siikabot/matrix"
+	"github.com/matrix-org/gomatrix"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type poll struct {
+	EventID  string              `json:"event_id"`
+	Creator  string              `json:"creator"`
+	Question string              `json:"question"`
+	Options  []string            `json:"options"`
+	Votes    map[string]pollVote `json:"votes"` // keyed by the event ID of the reaction
+}
+
+type pollVote struct {
+	User   string `json:"user"`
+	Option int    `json:"option"`
+}
+
+var pollKeys = []string{"1️⃣", "2️⃣", "3️⃣", "4️⃣", "5️⃣", "6️⃣", "7️⃣", "8️⃣", "9️⃣", "🔟"}
+
+// pollsLock guards the read-modify-write of the stored polls
+var pollsLock sync.Mutex
+
+// getPolls returns the open polls keyed by room ID, there can be only one open poll in a room at a time
+func getPolls() map[string]poll {
+	pollsJson := db.Get("polls")
+	var polls map[string]poll
+	if pollsJson != "" {
+		json.Unmarshal([]byte(pollsJson), &polls)
+	}
+	if polls == nil {
+		polls = make(map[string]poll)
+	}
+	return polls
+}
+
+func savePolls(polls map[string]poll) {
+	res, err := json.Marshal(polls)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	db.Set("polls", string(res))
+}
+
+// splitQuoted splits s by spaces, keeping double quoted parts together
+func splitQuoted(s string) []string {
+	var parts []string
+	var current strings.Builder
+	quoted, inPart := false, false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inPart = true
+		case r == ' ' && !quoted:
+			if inPart {
+				parts = append(parts, current.String())
+				current.Reset()
+				inPart = false
+			}
+		default:
+			current.WriteRune(r)
+			inPart = true
+		}
+	}
+	if inPart {
+		parts = append(parts, current.String())
+	}
+	return parts
+}
+
+// tally returns the number of voters of each option, each user is counted at most once per option
+func (p poll) tally() []int {
+	counts := make([]int, len(p.Options))
+	seen := make(map[pollVote]bool)
+	for _, v := range p.Votes {
+		if seen[v] || v.Option < 0 || v.Option >= len(counts) {
+			continue
+		}
+		seen[v] = true
+		counts[v.Option]++
+	}
+	return counts
+}
+
+func formatPoll(p poll) string {
+	var lines []string
+	for i, o := range p.Options {
+		lines = append(lines, "<li>"+pollKeys[i]+" "+html.EscapeString(o)+"</li>")
+	}
+	return "📊 <b>" + html.EscapeString(p.Question) + "</b><ul>" + strings.Join(lines, "") + "</ul>Vote by reacting with the option's number"
+}
+
+func formatPollResults(p poll) string {
+	counts := p.tally()
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+	var lines []string
+	for i, o := range p.Options {
+		percent := 0
+		if total > 0 {
+			percent = counts[i] * 100 / total
+		}
+		lines = append(lines, "<li>"+pollKeys[i]+" "+html.EscapeString(o)+": <b>"+strconv.Itoa(counts[i])+"</b> ("+strconv.Itoa(percent)+"%) "+
+			strings.Repeat("█", percent/10)+"</li>")
+	}
+	return "📊 Results of <b>" + html.EscapeString(p.Question) + "</b><ul>" + strings.Join(lines, "") + "</ul>" + strconv.Itoa(total) + " votes"
+}
+
+func pollCommand(roomID, sender, msg string) {
+	params := splitQuoted(msg)
+	if len(params) == 2 && params[1] == "close" {
+		closePoll(roomID, sender)
+		return
+	}
+	if len(params) < 4 {
+		client.SendMessage(roomID, "Usage: !poll \"<question>\" <option> <option> [option ...], or !poll close")
+		return
+	}
+	if len(params)-2 > len(pollKeys) {
+		client.SendMessage(roomID, "A poll can have at most "+strconv.Itoa(len(pollKeys))+" options")
+		return
+	}
+	p := poll{Creator: sender, Question: params[1], Options: params[2:], Votes: make(map[string]pollVote)}
+	// reserve the room for the poll before sending it, so that another poll can't be opened while it's being sent
+	pollsLock.Lock()
+	polls := getPolls()
+	if _, ok := polls[roomID]; ok {
+		pollsLock.Unlock()
+		client.SendMessage(roomID, "There is already an open poll in this room, close it first with !poll close")
+		return
+	}
+	polls[roomID] = p
+	savePolls(polls)
+	pollsLock.Unlock()
+	go func() {
+		var eventID string
+		select {
+		case eventID = <-client.SendFormattedMessage(roomID, formatPoll(p)):
+		case <-time.After(30 * time.Second):
+		}
+		pollsLock.Lock()
+		polls := getPolls()
+		reserved, ok := polls[roomID]
+		// the reservation may have been closed while the poll was being sent
+		ok = ok && reserved.EventID == "" && reserved.Creator == p.Creator
+		if ok {
+			if eventID == "" {
+				delete(polls, roomID)
+			} else {
+				p.EventID = eventID
+				polls[roomID] = p
+			}
+			savePolls(polls)
+		}
+		pollsLock.Unlock()
+		if eventID == "" {
+			log.Print("Failed to send poll to room " + roomID)
+			return
+		}
+		if !ok {
+			return
+		}
+		for i := range p.Options {
+			client.SendReaction(roomID, eventID, pollKeys[i])
+		}
+	}()
+}
+
+func closePoll(roomID, sender string) {
+	pollsLock.Lock()
+	polls := getPolls()
+	p, ok := polls[roomID]
+	if ok && (sender == p.Creator || sender == adminUser) {
+		delete(polls, roomID)
+		savePolls(polls)
+	}
+	pollsLock.Unlock()
+	if !ok {
+		client.SendMessage(roomID, "There is no open poll in this room")
+		return
+	}
+	if sender != p.Creator && sender != adminUser {
+		client.SendMessage(roomID, "Only the creator of the poll or an admin can close it")
+		return
+	}
+	client.SendFormattedMessage(roomID, formatPollResults(p))
+}
+
+func handleReactionEvent(event *gomatrix.Event) {
+	metrics.eventsHandled.With(prometheus.Labels{"event_type": "m.reaction", "msg_type": ""}).Inc()
+	if event.Sender == client.UserID {
+		return
+	}
+	eventID, key, ok := matrix.GetReaction(event)
+	if !ok {
+		return
+	}
+	option := -1
+	for i, k := range pollKeys {
+		if k == key {
+			option = i
+		}
+	}
+	if option < 0 {
+		return
+	}
+	pollsLock.Lock()
+	defer pollsLock.Unlock()
+	polls := getPolls()
+	p, ok := polls[event.RoomID]
+	if !ok || p.EventID != eventID || option >= len(p.Options) {
+		return
+	}
+	p.Votes[event.ID] = pollVote{event.Sender, option}
+	savePolls(polls)
+}
+
+func handleRedactionEvent(event *gomatrix.Event) {
+	metrics.eventsHandled.With(prometheus.Labels{"event_type": "m.room.redaction", "msg_type": ""}).Inc()
+	redacts := event.Redacts
+	if redacts == "" {
+		// since room version 11 the redacted event is in the content
+		redacts, _ = event.Content["redacts"].(string)
+	}
+	pollsLock.Lock()
+	defer pollsLock.Unlock()
+	polls := getPolls()
+	p, ok := polls[event.RoomID]
+	if !ok {
+		return
+	}
+	if _, ok := p.Votes[redacts]; ok {
+		delete(p.Votes, redacts)
+		savePolls(polls)
+	}
+}
@@ -0,0 +1,99 @@
+package bot
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+type quietHours struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+func getRoomQuietHours(roomID string) (quietHours, bool) {
+	var q quietHours
+	ok := getRoomSetting(roomID, "quiet_hours", &q)
+	return q, ok
+}
+
+// parseQuietHours parses a quiet hours window in the form start-end, for example 22:00-07:00
+func parseQuietHours(s string) (quietHours, error) {
+	window := strings.SplitN(s, "-", 2)
+	if len(window) != 2 {
+		return quietHours{}, errors.New("Quiet hours must be in the form <start>-<end>, for example 22:00-07:00")
+	}
+	start, startErr := time.Parse("15:04", window[0])
+	end, endErr := time.Parse("15:04", window[1])
+	if startErr != nil || endErr != nil || start.Equal(end) {
+		return quietHours{}, errors.New("Invalid quiet hours: " + s)
+	}
+	return quietHours{start.Format("15:04"), end.Format("15:04")}, nil
+}
+
+func (q quietHours) String() string {
+	return q.Start + "-" + q.End
+}
+
+// end returns the end of the quiet hours window if now is within it
+func (q quietHours) end(now time.Time) (time.Time, bool) {
+	startTime, err := time.Parse("15:04", q.Start)
+	if err != nil {
+		return time.Time{}, false
+	}
+	endTime, err := time.Parse("15:04", q.End)
+	if err != nil {
+		return time.Time{}, false
+	}
+	loc, _ := time.LoadLocation(timezone)
+	n := now.In(loc)
+	start := time.Date(n.Year(), n.Month(), n.Day(), startTime.Hour(), startTime.Minute(), 0, 0, loc)
+	end := time.Date(n.Year(), n.Month(), n.Day(), endTime.Hour(), endTime.Minute(), 0, 0, loc)
+	switch {
+	case start.Equal(end):
+		return time.Time{}, false
+	case start.Before(end):
+		return end, !n.Before(start) && n.Before(end)
+	case !n.Before(start): // window spans midnight, we're before midnight
+		return end.AddDate(0, 0, 1), true
+	default: // window spans midnight, we're after midnight
+		return end, n.Before(end)
+	}
+}
+
+// quietHoursEnd returns the end of the room's quiet hours if the room is currently within them
+func quietHoursEnd(roomID string, now time.Time) (time.Time, bool) {
+	q, ok := getRoomQuietHours(roomID)
+	if !ok {
+		return time.Time{}, false
+	}
+	return q.end(now)
+}
+
+func quiethours(roomID, sender, msg string) {
+	params := strings.Split(msg, " ")
+	if len(params) == 1 {
+		q, ok := getRoomQuietHours(roomID)
+		if !ok {
+			client.SendMessage(roomID, "No quiet hours set for this room")
+			return
+		}
+		client.SendMessage(roomID, "Quiet hours: "+q.Start+"-"+q.End+" ("+timezone+")")
+		return
+	}
+	if !checkPermission(roomID, sender, "admin") {
+		return
+	}
+	if params[1] == "off" {
+		deleteRoomSetting(roomID, "quiet_hours")
+		client.SendMessage(roomID, "Quiet hours disabled")
+		return
+	}
+	q, err := parseQuietHours(params[1])
+	if err != nil {
+		client.SendMessage(roomID, "Usage: !quiethours <start>-<end> or !quiethours off: "+err.Error())
+		return
+	}
+	setRoomSetting(roomID, "quiet_hours", q)
+	client.SendMessage(roomID, "Quiet hours set to "+q.Start+"-"+q.End+" ("+timezone+"), reminders due during them will be sent when they end")
+}
@@ -4,20 +4,53 @@ import (
 	"encoding/json"
 	"errors"
 	"log"
-	"reflect"
+	"math/rand"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 type reminder struct {
+	ID         int64  `json:"id"`
 	RemindTime int64  `json:"remind_time"`
 	User       string `json:"user"`
 	RoomID     string `json:"room_id"`
 	Message    string `json:"msg"`
 }
 
+type pendingReminder struct {
+	rem     reminder
+	expires time.Time
+}
+
 const timezone = "Europe/Helsinki"
 
+// similarReminderWindow is how close in time two reminders with the same message need to be to be considered duplicates
+const similarReminderWindow = 15 * time.Minute
+
+const (
+	reminderJitter         = 2 * time.Second
+	reminderDelayThreshold = time.Minute
+)
+
+// remindersLock guards the read-modify-write of the stored reminders
+var remindersLock sync.Mutex
+
+// scheduledReminders tracks the reminders that have a pending timer, so that no reminder is scheduled or fired twice
+var scheduledReminders = struct {
+	sync.Mutex
+	reminders map[reminder]bool
+	lastFired time.Time
+}{reminders: make(map[reminder]bool)}
+
+// pendingReminders holds reminders that were not created because of a similar existing reminder, waiting for confirmation
+var pendingReminders = struct {
+	sync.Mutex
+	reminders map[string]pendingReminder
+}{reminders: make(map[string]pendingReminder)}
+
 var dateTimeFormats = []string{
 	"2.1.2006-15:04", "15:04-2.1.2006",
 	"2.1.2006-15:04:05", "15:04:05-2.1.2006",
@@ -32,9 +65,37 @@ var timeFormats = []string{"15:04", "15:04:05"}
 var dateFormats = []string{"2.1.2006", "2006-1-2"}
 
 func initReminder() {
+	// reminders created before reminders had IDs need one for listing and cancelling
+	updateReminders(func(reminders []reminder) []reminder {
+		for i := range reminders {
+			if reminders[i].ID == 0 {
+				reminders[i].ID = nextReminderID()
+			}
+		}
+		return reminders
+	})
 	for _, r := range getReminders() {
 		startReminder(r)
 	}
+	registerJob("reminder dispatcher", reminderDispatcherStatus)
+}
+
+func reminderDispatcherStatus() string {
+	scheduledReminders.Lock()
+	scheduled := len(scheduledReminders.reminders)
+	lastFired := scheduledReminders.lastFired
+	scheduledReminders.Unlock()
+	var next time.Time
+	for _, r := range getReminders() {
+		if t := time.Unix(r.RemindTime, 0); next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+	nextFire := "none"
+	if !next.IsZero() {
+		nextFire = formatJobTime(next)
+	}
+	return strconv.Itoa(scheduled) + " scheduled, next due at " + nextFire + ", last fired at " + formatJobTime(lastFired)
 }
 
 func getReminders() []reminder {
@@ -46,6 +107,23 @@ func getReminders() []reminder {
 	return reminders
 }
 
+// nextReminderID allocates a new reminder ID, must be called with remindersLock held
+func nextReminderID() int64 {
+	id, _ := strconv.ParseInt(db.Get("reminder_next_id"), 10, 64)
+	if id < 1 {
+		id = 1
+	}
+	db.Set("reminder_next_id", strconv.FormatInt(id+1, 10))
+	return id
+}
+
+// updateReminders atomically replaces the stored reminders with the result of update
+func updateReminders(update func([]reminder) []reminder) {
+	remindersLock.Lock()
+	defer remindersLock.Unlock()
+	saveReminders(update(getReminders()))
+}
+
 func saveReminders(reminders []reminder) {
 	res, err := json.Marshal(reminders)
 	if err != nil {
@@ -56,56 +134,306 @@ func saveReminders(reminders []reminder) {
 }
 
 func startReminder(rem reminder) {
-	f := func() {
-		client.SendFormattedMessage(rem.RoomID, "<a href=\"https://matrix.to/#/"+rem.User+"\">"+client.GetDisplayName(rem.User)+"</a> "+rem.Message)
-		reminders := getReminders()
+	scheduledReminders.Lock()
+	if scheduledReminders.reminders[rem] {
+		scheduledReminders.Unlock()
+		return
+	}
+	scheduledReminders.reminders[rem] = true
+	scheduledReminders.Unlock()
+
+	var f func()
+	f = func() {
+		if end, quiet := quietHoursEnd(rem.RoomID, time.Now()); quiet {
+			time.AfterFunc(time.Until(end)+time.Duration(rand.Int63n(int64(reminderJitter))), f)
+			return
+		}
+		scheduledReminders.Lock()
+		scheduled := scheduledReminders.reminders[rem]
+		delete(scheduledReminders.reminders, rem)
+		if scheduled {
+			scheduledReminders.lastFired = time.Now()
+		}
+		scheduledReminders.Unlock()
+		if !scheduled { // already fired
+			return
+		}
+		msg := "<a href=\"https://matrix.to/#/" + rem.User + "\">" + client.GetDisplayName(rem.User) + "</a> " + rem.Message
+		dueTime := time.Unix(rem.RemindTime, 0)
+		if time.Since(dueTime) > reminderDelayThreshold {
+			loc, _ := time.LoadLocation(timezone)
+			msg += " <font color=\"gray\">(delayed, was due at " + dueTime.In(loc).Format("15:04:05 on 2.1.2006") + ")</font>"
+		}
+		if eventID := <-client.SendFormattedMessage(rem.RoomID, msg); eventID != "" {
+			recordFiredReminder(eventID, rem)
+		}
+		updateReminders(func(reminders []reminder) []reminder {
+			var newReminders []reminder
+			for _, r := range reminders {
+				if r.ID != rem.ID {
+					newReminders = append(newReminders, r)
+				}
+			}
+			return newReminders
+		})
+	}
+	duration := time.Until(time.Unix(rem.RemindTime, 0))
+	if duration < 0 { // past due, most likely the bot was down when this was supposed to fire
+		duration = 0
+	}
+	// spread out reminders that are due at the same time
+	time.AfterFunc(duration+time.Duration(rand.Int63n(int64(reminderJitter))), f)
+}
+
+// findSimilarReminder returns a pending reminder of the same user in the same room with the same message and a nearby time
+func findSimilarReminder(rem reminder) (reminder, bool) {
+	for _, r := range getReminders() {
+		if r.User != rem.User || r.RoomID != rem.RoomID {
+			continue
+		}
+		if !strings.EqualFold(strings.TrimSpace(r.Message), strings.TrimSpace(rem.Message)) {
+			continue
+		}
+		diff := time.Duration(r.RemindTime-rem.RemindTime) * time.Second
+		if diff < similarReminderWindow && diff > -similarReminderWindow {
+			return r, true
+		}
+	}
+	return reminder{}, false
+}
+
+func addReminder(rem reminder) {
+	updateReminders(func(reminders []reminder) []reminder {
+		rem.ID = nextReminderID()
+		return append(reminders, rem)
+	})
+	startReminder(rem)
+	reminderTime := time.Unix(rem.RemindTime, 0)
+	duration := time.Until(reminderTime).Truncate(time.Second)
+	loc, _ := time.LoadLocation(timezone)
+	client.SendFormattedMessage(rem.RoomID, "Reminding at "+reminderTime.In(loc).Format("15:04:05 on 2.1.2006")+" (in "+duration.String()+"): "+rem.Message)
+}
+
+func listReminders(roomID, sender string) {
+	var reminders []reminder
+	for _, r := range getReminders() {
+		if r.User == sender && r.RoomID == roomID {
+			reminders = append(reminders, r)
+		}
+	}
+	if len(reminders) == 0 {
+		client.SendMessage(roomID, "You have no pending reminders in this room")
+		return
+	}
+	sort.Slice(reminders, func(i, j int) bool { return reminders[i].RemindTime < reminders[j].RemindTime })
+	loc, _ := time.LoadLocation(timezone)
+	var lines []string
+	for _, r := range reminders {
+		reminderTime := time.Unix(r.RemindTime, 0)
+		duration := time.Until(reminderTime).Truncate(time.Second)
+		lines = append(lines, "<li><b>#"+strconv.FormatInt(r.ID, 10)+"</b> at "+reminderTime.In(loc).Format("15:04:05 on 2.1.2006")+
+			" (in "+duration.String()+"): "+r.Message+"</li>")
+	}
+	client.SendFormattedMessage(roomID, "Your pending reminders in this room:<ul>"+strings.Join(lines, "")+"</ul>")
+}
+
+func cancelReminder(roomID, sender, idParam string) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(strings.TrimSpace(idParam), "#"), 10, 64)
+	if err != nil {
+		client.SendMessage(roomID, "Invalid reminder ID: "+idParam)
+		return
+	}
+	var cancelled *reminder
+	var notAllowed bool
+	updateReminders(func(reminders []reminder) []reminder {
 		var newReminders []reminder
 		for _, r := range reminders {
-			if !reflect.DeepEqual(rem, r) {
-				newReminders = append(newReminders, r)
+			if r.ID == id && r.RoomID == roomID {
+				if r.User != sender && sender != adminUser {
+					notAllowed = true
+				} else {
+					r := r
+					cancelled = &r
+					continue
+				}
 			}
+			newReminders = append(newReminders, r)
 		}
-		saveReminders(newReminders)
+		return newReminders
+	})
+	if notAllowed {
+		client.SendMessage(roomID, "You can only cancel your own reminders")
+		return
 	}
-	duration := rem.RemindTime - time.Now().Unix()
-	if duration <= 0 {
-		f()
-	} else {
-		time.AfterFunc(time.Duration(duration)*time.Second, f)
+	if cancelled == nil {
+		client.SendMessage(roomID, "No pending reminder #"+strconv.FormatInt(id, 10)+" in this room")
+		return
+	}
+	scheduledReminders.Lock()
+	delete(scheduledReminders.reminders, *cancelled)
+	scheduledReminders.Unlock()
+	client.SendFormattedMessage(roomID, "Cancelled reminder #"+strconv.FormatInt(id, 10)+": "+cancelled.Message)
+}
+
+func confirmReminder(roomID, sender string) {
+	key := roomID + "|" + sender
+	pendingReminders.Lock()
+	pending, ok := pendingReminders.reminders[key]
+	delete(pendingReminders.reminders, key)
+	pendingReminders.Unlock()
+	if !ok || time.Now().After(pending.expires) {
+		client.SendMessage(roomID, "No reminder waiting for confirmation")
+		return
+	}
+	if pending.rem.RemindTime <= time.Now().Unix() {
+		client.SendMessage(roomID, "The reminder time has already passed")
+		return
+	}
+	addReminder(pending.rem)
+}
+
+func remindLocation(roomID, sender string, params []string) {
+	if len(params) < 3 {
+		client.SendMessage(roomID, "Sunrise and sunset reminders in this room use the location "+getRoomLocation(roomID).String())
+		return
+	}
+	if !checkPermission(roomID, sender, "admin") {
+		return
+	}
+	loc, err := parseLocation(params[2])
+	if err != nil {
+		client.SendMessage(roomID, "Usage: !remind location <latitude> <longitude>: "+err.Error())
+		return
 	}
+	setRoomSetting(roomID, "location", loc)
+	client.SendMessage(roomID, "Location set to "+loc.String())
+}
+
+// remindSunEvent returns the time of the next sunrise or sunset at the room's location
+func remindSunEvent(now time.Time, roomID, event string) (time.Time, error) {
+	loc, _ := time.LoadLocation(timezone)
+	roomLocation := getRoomLocation(roomID)
+	day := now.In(loc)
+	for i := 0; i < 366; i++ { // polar night or day may last for months
+		sunrise, sunset, ok := sunTimes(day.AddDate(0, 0, i), roomLocation)
+		if !ok {
+			continue
+		}
+		t := sunset
+		if event == "sunrise" {
+			t = sunrise
+		}
+		if t.After(now) {
+			return t, nil
+		}
+	}
+	return time.Unix(0, 0), errors.New("There is no " + event + " at this room's location within the next year")
 }
 
 func remind(roomID, sender, msg, msgType, formattedBody string) {
-	params := strings.SplitN(msg, " ", 3)
+	params := remindParams(msg)
+	if len(params) == 2 && params[1] == "confirm" {
+		confirmReminder(roomID, sender)
+		return
+	}
+	if len(params) == 2 && params[1] == "list" {
+		listReminders(roomID, sender)
+		return
+	}
+	if len(params) >= 2 && params[1] == "cancel" {
+		if len(params) < 3 {
+			client.SendMessage(roomID, "Usage: !remind cancel <id>")
+			return
+		}
+		cancelReminder(roomID, sender, params[2])
+		return
+	}
+	if len(params) >= 2 && params[1] == "location" {
+		remindLocation(roomID, sender, params)
+		return
+	}
+	if len(params) >= 2 && params[1] == "test" {
+		if !checkPermission(roomID, sender, "admin") {
+			return
+		}
+	}
 	if len(params) < 3 {
-		client.SendMessage(roomID, "Usage: !remind <time, date, datetime or duration> <message>")
+		client.SendMessage(roomID, "Usage: !remind <time, date, datetime, duration, sunrise or sunset> <message>")
 		return
 	}
 
 	t := time.Now()
-	reminderTime, durationErr := remindDuration(t, params[1])
-	var timeErr error
-	if durationErr != nil {
-		reminderTime, timeErr = remindTime(t, params[1])
+	var reminderTime time.Time
+	timeWords := 1
+	if params[1] == "test" {
+		// go through the exact same path as real reminders, just due almost immediately
+		reminderTime = t.Add(2 * time.Second)
+	} else if event := strings.ToLower(params[1]); event == "sunrise" || event == "sunset" {
+		var err error
+		if reminderTime, err = remindSunEvent(t, roomID, event); err != nil {
+			client.SendMessage(roomID, err.Error())
+			return
+		}
+	} else {
+		var durationErr, timeErr error
+		reminderTime, durationErr = remindDuration(t, params[1])
+		if durationErr != nil {
+			reminderTime, timeErr = remindTime(t, params[1])
+		}
+		if timeErr != nil {
+			var naturalErr error
+			reminderTime, timeWords, naturalErr = remindNaturalTime(t, strings.Split(msg, " ")[1:])
+			if naturalErr != nil {
+				client.SendFormattedMessage(roomID, "Invalid date/time or duration: "+params[1]+"<br>duration error: "+durationErr.Error()+"<br> date/time error: "+timeErr.Error()+
+					"<br>Natural language times such as <b>tomorrow at noon</b>, <b>next friday 17:30</b> or <b>in 2 weeks</b> are also accepted")
+				return
+			}
+		}
 	}
-	if timeErr != nil {
-		client.SendFormattedMessage(roomID, "Invalid date/time or duration: "+params[1]+"<br>duration error: "+durationErr.Error()+"<br> date/time error: "+timeErr.Error())
+
+	reminderText, ok := remindMessage(params, formattedBody, msgType, timeWords)
+	if !ok {
+		client.SendMessage(roomID, "Usage: !remind <time, date, datetime, duration, sunrise or sunset> <message>")
+		return
+	}
+	rem := reminder{RemindTime: reminderTime.Unix(), User: sender, RoomID: roomID, Message: reminderText}
+	if existing, ok := findSimilarReminder(rem); ok {
+		pendingReminders.Lock()
+		pendingReminders.reminders[roomID+"|"+sender] = pendingReminder{rem, time.Now().Add(5 * time.Minute)}
+		pendingReminders.Unlock()
+		loc, _ := time.LoadLocation(timezone)
+		client.SendFormattedMessage(roomID, "You already have a similar reminder at "+time.Unix(existing.RemindTime, 0).In(loc).Format("15:04:05 on 2.1.2006")+
+			": "+existing.Message+"<br>Use <b>!remind confirm</b> within 5 minutes to add another one anyway")
 		return
 	}
+	addReminder(rem)
+}
 
-	formattedParams := strings.SplitN(formattedBody, " ", 3)
-	var reminderText string
-	if msgType == "org.matrix.custom.html" && len(formattedParams) >= 3 {
-		reminderText = formattedParams[2]
-	} else {
-		reminderText = strings.Replace(params[2], "\n", "<br>", -1)
+// remindParams splits the command to the command name, the first word of the time and the rest of the message.
+// A test reminder without a message gets a default one
+func remindParams(msg string) []string {
+	params := strings.SplitN(msg, " ", 3)
+	if len(params) == 2 && params[1] == "test" {
+		params = append(params, "test reminder")
 	}
-	rem := reminder{reminderTime.Unix(), sender, roomID, reminderText}
-	startReminder(rem)
-	saveReminders(append(getReminders(), rem))
-	duration := reminderTime.Sub(t).Truncate(time.Second)
-	loc, _ := time.LoadLocation(timezone)
-	client.SendFormattedMessage(roomID, "Reminding at "+reminderTime.In(loc).Format("15:04:05 on 2.1.2006")+" (in "+duration.String()+"): "+reminderText)
+	return params
+}
+
+// remindMessage returns the reminder message following the timeWords words of the time, preferring the formatted
+// body if there is one
+func remindMessage(params []string, formattedBody, msgType string, timeWords int) (string, bool) {
+	if len(params) < 3 {
+		return "", false
+	}
+	rest := strings.SplitN(params[2], " ", timeWords)
+	if len(rest) < timeWords {
+		return "", false
+	}
+	formattedParams := strings.SplitN(formattedBody, " ", timeWords+2)
+	if msgType == "org.matrix.custom.html" && len(formattedParams) >= timeWords+2 {
+		return formattedParams[timeWords+1], true
+	}
+	return strings.Replace(rest[timeWords-1], "\n", "<br>", -1), true
 }
 
 func remindDuration(now time.Time, param string) (time.Time, error) {
@@ -0,0 +1,27 @@
+package bot
+
+import "testing"
+
+func TestRemindMessage(t *testing.T) {
+	tests := []struct {
+		msg, formattedBody, msgType string
+		timeWords                   int
+		want                        string
+		ok                          bool
+	}{
+		{"!remind test", "", "", 1, "test reminder", true},
+		{"!remind test check this", "", "", 1, "check this", true},
+		{"!remind 5m tea", "", "", 1, "tea", true},
+		{"!remind 5m line\nbreak", "", "", 1, "line<br>break", true},
+		{"!remind 5m", "", "", 1, "", false},
+		{"!remind tomorrow at noon lunch time", "", "", 3, "lunch time", true},
+		{"!remind tomorrow at noon", "", "", 3, "", false},
+		{"!remind tomorrow at noon *lunch*", "!remind tomorrow at noon <em>lunch</em>", "org.matrix.custom.html", 3, "<em>lunch</em>", true},
+	}
+	for _, test := range tests {
+		got, ok := remindMessage(remindParams(test.msg), test.formattedBody, test.msgType, test.timeWords)
+		if got != test.want || ok != test.ok {
+			t.Errorf("%q: got %q, %v, want %q, %v", test.msg, got, ok, test.want, test.ok)
+		}
+	}
+}
@@ -2,11 +2,13 @@ package bot
 
 import (
 	"encoding/json"
-	"errors"
-	"net/http"
+	"math"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/Scrin/siikabot/chart"
+	siikagrafana "github.com/Scrin/siikabot/grafana"
 )
 
 type ruuviEndpoint struct {
@@ -50,9 +52,16 @@ func ruuvi(roomID, sender, msg string) {
 		}
 	case "config":
 		client.SendMessage(roomID, formatRuuviEndpoints(getRuuviEndpoints()))
+	case "alert":
+		ruuviAlertCommand(roomID, sender, params)
+	case "graph":
+		if len(params) < 5 {
+			client.SendMessage(roomID, "Usage: !ruuvi graph <name> <field> <duration>")
+			return
+		}
+		go ruuviGraph(roomID, strings.Join(params[2:len(params)-2], " "), params[len(params)-2], params[len(params)-1])
 	case "add":
-		if sender != adminUser {
-			client.SendMessage(roomID, "Only admins can use this command")
+		if !checkPermission(roomID, sender, "admin") {
 			return
 		}
 		if len(params) < 4 {
@@ -67,8 +76,7 @@ func ruuvi(roomID, sender, msg string) {
 		db.Set("ruuvi_endpoints", string(res))
 		client.SendMessage(roomID, formatRuuviEndpoints(endpoints))
 	case "remove":
-		if sender != adminUser {
-			client.SendMessage(roomID, "Only admins can use this command")
+		if !checkPermission(roomID, sender, "admin") {
 			return
 		}
 		if len(params) < 3 {
@@ -90,63 +98,91 @@ func ruuvi(roomID, sender, msg string) {
 		db.Set("ruuvi_endpoints", string(res))
 		client.SendMessage(roomID, formatRuuviEndpoints(newEndpoints))
 	case "-":
-		go func() {
-			start := time.Now().Unix()
-			outChan, done := client.SendStreamingFormattedNotice(roomID)
-			for {
-				outChan <- formatRuuviData() + "<font color=\"gray\">[last updated at " + time.Now().Format("15:04:05") + "]</font>"
-				time.Sleep(10 * time.Second)
-				if start+600 < time.Now().Unix() {
-					break
-				}
-			}
-			outChan <- formatRuuviData()
-			close(done)
-		}()
+		settings, err := parseStreamingSettings(roomID, params[2:])
+		if err != nil {
+			client.SendMessage(roomID, "Usage: !ruuvi - [interval] [duration]: "+err.Error())
+			return
+		}
+		streamFormattedNotice(roomID, settings, formatRuuviData)
 	}
 }
 
-func ruuviQueryGrafana(baseURL, tagName string, offset time.Duration, fields ...string) (*grafanaResponse, error) {
-	tagName = strings.Replace(tagName, `"`, "", -1)
-	var queryBuilder strings.Builder
-	queryBuilder.WriteString(baseURL)
-	queryBuilder.WriteString(`&q=SELECT%20`)
-	first := true
-	for _, f := range fields {
-		if first {
-			first = false
-		} else {
-			queryBuilder.WriteString(",")
-		}
-		queryBuilder.WriteString(`last("`)
-		queryBuilder.WriteString(strings.Replace(f, `"`, "", -1))
-		queryBuilder.WriteString(`")`)
-	}
-	queryBuilder.WriteString(`%20FROM%20"ruuvi_measurements"%20WHERE%20("name"%20%3D%20%27`)
-	queryBuilder.WriteString(tagName)
-	queryBuilder.WriteString(`%27)%20AND%20time%20<%3D%20now()%20-%20`)
-	queryBuilder.WriteString(strconv.FormatInt(int64(offset/time.Second), 10))
-	queryBuilder.WriteString(`s%20AND%20time%20>%3D%20now()%20-%20`)
-	queryBuilder.WriteString(strconv.FormatInt(int64((offset+time.Hour)/time.Second), 10))
-	queryBuilder.WriteString(`s`)
-	resp, err := http.Get(queryBuilder.String())
+const (
+	maxRuuviGraphDuration = 30 * 24 * time.Hour
+	ruuviGraphPoints      = 300
+)
+
+func ruuviGraph(roomID, name, field, durationParam string) {
+	duration, err := time.ParseDuration(durationParam)
 	if err != nil {
-		if err.Error() != "EOF" {
-			return nil, err
+		client.SendMessage(roomID, "Invalid duration: "+err.Error())
+		return
+	}
+	if duration < time.Minute || duration > maxRuuviGraphDuration {
+		client.SendMessage(roomID, "Duration must be between 1m and "+maxRuuviGraphDuration.String())
+		return
+	}
+	var endpoint *ruuviEndpoint
+	for _, e := range getRuuviEndpoints() {
+		if e.Name == name {
+			endpoint = &e
+			break
+		}
+	}
+	if endpoint == nil {
+		client.SendMessage(roomID, name+" not found")
+		return
+	}
+	interval := (duration / ruuviGraphPoints).Round(time.Second)
+	if interval < 10*time.Second {
+		interval = 10 * time.Second
+	}
+	grafanaResp, err := siikagrafana.Query(siikagrafana.HistoryQueryURL(endpoint.BaseURL, "ruuvi_measurements", "name", endpoint.TagName, field, duration, interval))
+	if err != nil {
+		client.SendMessage(roomID, err.Error())
+		return
+	}
+	var points []chart.Point
+	for _, row := range grafanaResp.Results[0].Series[0].Values {
+		if len(row) < 2 {
+			continue
+		}
+		t, err := siikagrafana.Time(row[0])
+		if err != nil {
+			continue
 		}
-		resp, err = http.Get(queryBuilder.String())
+		v, err := siikagrafana.Float(row[1])
+		if err != nil {
+			continue
+		}
+		points = append(points, chart.Point{X: float64(t.Unix()), Y: v})
+	}
+	loc, _ := time.LoadLocation(timezone)
+	timeLayout := "15:04"
+	if duration > 24*time.Hour {
+		timeLayout = "2.1. 15:04"
 	}
+	formatTime := func(x float64) string {
+		return time.Unix(int64(x), 0).In(loc).Format(timeLayout)
+	}
+	img, err := chart.RenderLine(points, 800, 300, formatTime, nil)
 	if err != nil {
-		return nil, err
+		client.SendMessage(roomID, err.Error())
+		return
+	}
+	min, max := points[0].Y, points[0].Y
+	for _, p := range points {
+		min, max = math.Min(min, p.Y), math.Max(max, p.Y)
 	}
-	var grafanaResp grafanaResponse
-	if err = json.NewDecoder(resp.Body).Decode(&grafanaResp); err != nil {
-		return nil, err
-	} else if len(grafanaResp.Results) < 1 || len(grafanaResp.Results[0].Series) < 1 {
-		return nil, errors.New("No data")
+	description := name + " " + field + " over " + duration.String() + ": min " + strconv.FormatFloat(min, 'f', 2, 64) +
+		", max " + strconv.FormatFloat(max, 'f', 2, 64) + ", latest " + strconv.FormatFloat(points[len(points)-1].Y, 'f', 2, 64)
+	if _, err := client.SendImage(roomID, description, img); err != nil {
+		client.SendMessage(roomID, "Failed to upload graph: "+err.Error())
 	}
-	return &grafanaResp, nil
+}
 
+func ruuviQueryGrafana(baseURL, tagName string, offset time.Duration, fields ...string) (*siikagrafana.Response, error) {
+	return siikagrafana.Query(siikagrafana.LastQueryURL(baseURL, "ruuvi_measurements", "name", tagName, offset, fields...))
 }
 
 func queryRuuviData(roomID, name, tagName, field string) {
@@ -158,9 +194,7 @@ func queryRuuviData(roomID, name, tagName, field string) {
 			if err != nil {
 				respLines = append(respLines, e.Name+" error: "+err.Error())
 			} else {
-				allValues := grafanaResp.Results[0].Series[0].Values
-				latestValues := allValues[len(allValues)-1]
-				value := strconv.FormatFloat(latestValues[1].(float64), 'f', 2, 64)
+				value := grafanaResp.FormattedValue()
 				respLines = append(respLines, e.Name+" "+field+": <b>"+value+"</b>")
 			}
 		}
@@ -175,9 +209,7 @@ func queryRuuviData(roomID, name, tagName, field string) {
 			if err != nil {
 				client.SendMessage(roomID, err.Error())
 			} else {
-				allValues := grafanaResp.Results[0].Series[0].Values
-				latestValues := allValues[len(allValues)-1]
-				value := strconv.FormatFloat(latestValues[1].(float64), 'f', 2, 64)
+				value := grafanaResp.FormattedValue()
 				client.SendFormattedMessage(roomID, e.Name+" "+tagName+" "+field+": <b>"+value+"</b>")
 			}
 			ok = true
@@ -189,6 +221,22 @@ func queryRuuviData(roomID, name, tagName, field string) {
 	}
 }
 
+// ruuviFloats returns the values at the given column indexes of a response row as floats
+func ruuviFloats(row []interface{}, columns ...int) ([]float64, error) {
+	var values []float64
+	for _, c := range columns {
+		if c >= len(row) {
+			return nil, siikagrafana.ErrNoData
+		}
+		v, err := siikagrafana.Float(row[c])
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
 func formatRuuviData() string {
 	endpoints := getRuuviEndpoints()
 	var respLines []string
@@ -208,16 +256,28 @@ func formatRuuviData() string {
 			respLines = append(respLines, "<p>"+e.Name+" error: "+err.Error()+"</p>")
 			continue
 		}
-		currentValues := current.Results[0].Series[0].Values[0]
-		hourAgoValues := hourAgo.Results[0].Series[0].Values[0]
-		yesterdayValues := yesterday.Results[0].Series[0].Values[0]
-		temp := strconv.FormatFloat(currentValues[1].(float64), 'f', 2, 64)
-		humi := strconv.FormatFloat(currentValues[2].(float64), 'f', 2, 64)
-		press := strconv.FormatFloat(currentValues[3].(float64)/100, 'f', 2, 64)
-		lastHourTemp := strconv.FormatFloat(hourAgoValues[1].(float64), 'f', 2, 64)
-		yesterdayTemp := strconv.FormatFloat(yesterdayValues[1].(float64), 'f', 2, 64)
-		lastHourDelta := strconv.FormatFloat(currentValues[1].(float64)-hourAgoValues[1].(float64), 'f', 2, 64)
-		yesterdayDelta := strconv.FormatFloat(currentValues[1].(float64)-yesterdayValues[1].(float64), 'f', 2, 64)
+		values, err := ruuviFloats(current.LastRow(), 1, 2, 3)
+		if err != nil {
+			respLines = append(respLines, "<p>"+e.Name+" error: "+err.Error()+"</p>")
+			continue
+		}
+		hourAgoValues, err := ruuviFloats(hourAgo.LastRow(), 1)
+		if err != nil {
+			respLines = append(respLines, "<p>"+e.Name+" error: "+err.Error()+"</p>")
+			continue
+		}
+		yesterdayValues, err := ruuviFloats(yesterday.LastRow(), 1)
+		if err != nil {
+			respLines = append(respLines, "<p>"+e.Name+" error: "+err.Error()+"</p>")
+			continue
+		}
+		temp := strconv.FormatFloat(values[0], 'f', 2, 64)
+		humi := strconv.FormatFloat(values[1], 'f', 2, 64)
+		press := strconv.FormatFloat(values[2]/100, 'f', 2, 64)
+		lastHourTemp := strconv.FormatFloat(hourAgoValues[0], 'f', 2, 64)
+		yesterdayTemp := strconv.FormatFloat(yesterdayValues[0], 'f', 2, 64)
+		lastHourDelta := strconv.FormatFloat(values[0]-hourAgoValues[0], 'f', 2, 64)
+		yesterdayDelta := strconv.FormatFloat(values[0]-yesterdayValues[0], 'f', 2, 64)
 		respLines = append(respLines, "<span>"+e.Name+": <b>"+temp+"</b> ºC, <b>"+humi+"</b> %, <b>"+press+"</b> hPa</span><ul>"+
 			"<li>1h ago: <b>"+lastHourTemp+"</b> ºC (changed <b>"+lastHourDelta+"</b> ºC since 1h ago)</li>"+
 			"<li>24h ago: <b>"+yesterdayTemp+"</b> ºC (changed <b>"+yesterdayDelta+"</b> ºC since yesterday)</li></ul>")
@@ -0,0 +1,98 @@
+package bot
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+type firedReminder struct {
+	EventID  string   `json:"event_id"`
+	Reminder reminder `json:"reminder"`
+	FiredAt  int64    `json:"fired_at"`
+}
+
+// firedReminderRetention is how long fired reminders can be snoozed
+const firedReminderRetention = 7 * 24 * time.Hour
+
+// firedRemindersLock guards the read-modify-write of the stored fired reminders
+var firedRemindersLock sync.Mutex
+
+func getFiredReminders() []firedReminder {
+	firedJson := db.Get("fired_reminders")
+	var fired []firedReminder
+	if firedJson != "" {
+		json.Unmarshal([]byte(firedJson), &fired)
+	}
+	return fired
+}
+
+func saveFiredReminders(fired []firedReminder) {
+	res, err := json.Marshal(fired)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	db.Set("fired_reminders", string(res))
+}
+
+// recordFiredReminder remembers the message of a fired reminder so that it can be snoozed later
+func recordFiredReminder(eventID string, rem reminder) {
+	firedRemindersLock.Lock()
+	defer firedRemindersLock.Unlock()
+	cutoff := time.Now().Add(-firedReminderRetention).Unix()
+	var fired []firedReminder
+	for _, f := range getFiredReminders() {
+		if f.FiredAt >= cutoff {
+			fired = append(fired, f)
+		}
+	}
+	saveFiredReminders(append(fired, firedReminder{eventID, rem, time.Now().Unix()}))
+}
+
+// findFiredReminder returns the fired reminder with the given message event ID,
+// or the latest reminder fired for the user in the room if eventID is empty
+func findFiredReminder(roomID, user, eventID string) (firedReminder, bool) {
+	fired := getFiredReminders()
+	for i := len(fired) - 1; i >= 0; i-- {
+		f := fired[i]
+		if eventID != "" && f.EventID == eventID {
+			return f, true
+		}
+		if eventID == "" && f.Reminder.RoomID == roomID && f.Reminder.User == user {
+			return f, true
+		}
+	}
+	return firedReminder{}, false
+}
+
+func snooze(roomID, sender, msg, replyTo string) {
+	params := strings.Split(msg, " ")
+	durationParam := "10m"
+	if len(params) > 1 {
+		durationParam = params[1]
+	}
+	fired, ok := findFiredReminder(roomID, sender, replyTo)
+	if !ok {
+		if replyTo != "" {
+			client.SendMessage(roomID, "That message is not a reminder, or it is too old to snooze")
+		} else {
+			client.SendMessage(roomID, "No recent reminders to snooze. Usage: !snooze [duration], optionally as a reply to a reminder")
+		}
+		return
+	}
+	if fired.Reminder.User != sender || fired.Reminder.RoomID != roomID {
+		client.SendMessage(roomID, "You can only snooze your own reminders")
+		return
+	}
+	reminderTime, err := remindDuration(time.Now(), durationParam)
+	if err != nil {
+		client.SendMessage(roomID, "Invalid duration: "+durationParam+": "+err.Error())
+		return
+	}
+	rem := fired.Reminder
+	rem.RemindTime = reminderTime.Unix()
+	addReminder(rem)
+}
@@ -0,0 +1,99 @@
+package bot
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+type streamingSettings struct {
+	Interval time.Duration `json:"interval"`
+	Duration time.Duration `json:"duration"`
+}
+
+const (
+	defaultStreamingInterval = 10 * time.Second
+	defaultStreamingDuration = 10 * time.Minute
+	minStreamingInterval     = 5 * time.Second
+	maxStreamingDuration     = time.Hour
+)
+
+func getRoomStreamingSettings(roomID string) streamingSettings {
+	var s streamingSettings
+	if getRoomSetting(roomID, "streaming", &s) {
+		return s
+	}
+	return streamingSettings{defaultStreamingInterval, defaultStreamingDuration}
+}
+
+func (s streamingSettings) String() string {
+	return s.Interval.String() + " " + s.Duration.String()
+}
+
+// parseStreamingSettings parses the optional interval and duration arguments of a streaming command,
+// falling back to the room's defaults for the ones not given
+func parseStreamingSettings(roomID string, args []string) (streamingSettings, error) {
+	s := getRoomStreamingSettings(roomID)
+	var err error
+	if len(args) > 0 {
+		if s.Interval, err = time.ParseDuration(args[0]); err != nil {
+			return s, err
+		}
+	}
+	if len(args) > 1 {
+		if s.Duration, err = time.ParseDuration(args[1]); err != nil {
+			return s, err
+		}
+	}
+	if s.Interval < minStreamingInterval {
+		return s, errors.New("Update interval must be at least " + minStreamingInterval.String())
+	}
+	if s.Duration > maxStreamingDuration {
+		return s, errors.New("Duration must be at most " + maxStreamingDuration.String())
+	}
+	if s.Duration < s.Interval {
+		return s, errors.New("Duration must be at least the update interval")
+	}
+	return s, nil
+}
+
+// streamFormattedNotice sends a formatted notice and keeps updating it with the output of format at the given interval
+// until the duration has passed, after which it is updated one last time without the last updated timestamp
+func streamFormattedNotice(roomID string, settings streamingSettings, format func() string) {
+	go func() {
+		start := time.Now()
+		outChan, done := client.SendStreamingFormattedNotice(roomID)
+		for {
+			outChan <- format() + "<br><font color=\"gray\">[last updated at " + time.Now().Format("15:04:05") + "]</font>"
+			time.Sleep(settings.Interval)
+			if time.Since(start) > settings.Duration {
+				break
+			}
+		}
+		outChan <- format()
+		close(done)
+	}()
+}
+
+func streaming(roomID, sender, msg string) {
+	params := strings.Split(msg, " ")
+	if len(params) == 1 {
+		s := getRoomStreamingSettings(roomID)
+		client.SendMessage(roomID, "Live updates in this room refresh every "+s.Interval.String()+" for "+s.Duration.String())
+		return
+	}
+	if !checkPermission(roomID, sender, "admin") {
+		return
+	}
+	if len(params) != 3 {
+		client.SendMessage(roomID, "Usage: !streaming <interval> <duration>, for example !streaming 10s 10m")
+		return
+	}
+	s, err := parseStreamingSettings(roomID, params[1:])
+	if err != nil {
+		client.SendMessage(roomID, err.Error())
+		return
+	}
+	setRoomSetting(roomID, "streaming", s)
+	client.SendMessage(roomID, "Live updates in this room will refresh every "+s.Interval.String()+" for "+s.Duration.String())
+}
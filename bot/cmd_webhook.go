@@ -0,0 +1,155 @@
+package bot
+
+import (
+	"sort"
+	"strings"
+)
+
+func formatGrafanaWebhooks(webhooks []grafanaWebhook) string {
+	respLines := []string{"Current Grafana webhooks: "}
+	for _, w := range webhooks {
+		respLines = append(respLines, w.Name+": "+w.RoomID)
+	}
+	return strings.Join(respLines, "\n")
+}
+
+func webhook(roomID, msg string) {
+	params := strings.Split(msg, " ")
+	if len(params) < 3 {
+		client.SendMessage(roomID, "Usage: !webhook [grafana/alertmanager/github] <...>")
+		return
+	}
+	switch params[1] {
+	case "grafana":
+		grafanaWebhookCommand(roomID, params)
+	case "alertmanager":
+		alertmanagerRouteCommand(roomID, params)
+	case "github":
+		githubRouteCommand(roomID, params)
+	default:
+		client.SendMessage(roomID, "Unknown webhook type: "+params[1])
+	}
+}
+
+func grafanaWebhookCommand(roomID string, params []string) {
+	switch params[2] {
+	case "list":
+		client.SendMessage(roomID, formatGrafanaWebhooks(getGrafanaWebhooks()))
+	case "create":
+		if len(params) < 5 {
+			client.SendMessage(roomID, "Usage: !webhook grafana create <name> <room-id>")
+			return
+		}
+		// the secret is posted in the room and stays in its history, so don't post it where others can read it
+		if !client.IsDirectRoom(roomID, adminUser) {
+			client.SendMessage(roomID, "Webhooks can only be created in a direct message room with the bot")
+			return
+		}
+		if _, ok := findGrafanaWebhook(params[3]); ok {
+			client.SendMessage(roomID, "Webhook "+params[3]+" already exists")
+			return
+		}
+		secret, err := newAPIToken()
+		if err != nil {
+			client.SendMessage(roomID, err.Error())
+			return
+		}
+		saveGrafanaWebhooks(append(getGrafanaWebhooks(), grafanaWebhook{params[3], hashAPIToken(secret), params[4]}))
+		client.SendMessage(roomID, "Created webhook "+params[3]+" for room "+params[4]+" at /api/webhooks/grafana/"+params[3]+
+			"\nUse the secret as the bearer token of the contact point, it will not be shown again: "+secret)
+	case "remove":
+		if len(params) < 4 {
+			client.SendMessage(roomID, "Usage: !webhook grafana remove <name>")
+			return
+		}
+		var newWebhooks []grafanaWebhook
+		for _, w := range getGrafanaWebhooks() {
+			if w.Name != params[3] {
+				newWebhooks = append(newWebhooks, w)
+			}
+		}
+		saveGrafanaWebhooks(newWebhooks)
+		client.SendMessage(roomID, formatGrafanaWebhooks(newWebhooks))
+	case "route":
+		if len(params) < 4 {
+			client.SendMessage(roomID, "Usage: !webhook grafana route <name> [room-id]")
+			return
+		}
+		if _, ok := findGrafanaWebhook(params[3]); !ok {
+			client.SendMessage(roomID, "Webhook "+params[3]+" not found")
+			return
+		}
+		target := roomID
+		if len(params) > 4 {
+			target = params[4]
+		}
+		routeGrafanaWebhook(params[3], target)
+		client.SendMessage(roomID, formatGrafanaWebhooks(getGrafanaWebhooks()))
+	default:
+		client.SendMessage(roomID, "Usage: !webhook grafana [create/remove/route/list] <...>")
+	}
+}
+
+func formatGithubRoutes(routes map[string][]string) string {
+	var repos []string
+	for repo := range routes {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+	respLines := []string{"Current GitHub routes: "}
+	for _, repo := range repos {
+		respLines = append(respLines, repo+": "+strings.Join(routes[repo], " "))
+	}
+	return strings.Join(respLines, "\n")
+}
+
+func githubRouteCommand(roomID string, params []string) {
+	switch params[2] {
+	case "list":
+		client.SendMessage(roomID, formatGithubRoutes(getGithubRoutes()))
+	case "route":
+		if len(params) < 4 {
+			client.SendMessage(roomID, "Usage: !webhook github route <owner/repo> [room-id]")
+			return
+		}
+		target := roomID
+		if len(params) > 4 {
+			target = params[4]
+		}
+		routes := getGithubRoutes()
+		for _, r := range routes[params[3]] {
+			if r == target {
+				client.SendMessage(roomID, params[3]+" is already routed to "+target)
+				return
+			}
+		}
+		routes[params[3]] = append(routes[params[3]], target)
+		saveGithubRoutes(routes)
+		client.SendMessage(roomID, formatGithubRoutes(routes))
+	case "unroute":
+		if len(params) < 4 {
+			client.SendMessage(roomID, "Usage: !webhook github unroute <owner/repo> [room-id]")
+			return
+		}
+		target := roomID
+		if len(params) > 4 {
+			target = params[4]
+		}
+		routes := getGithubRoutes()
+		var newRooms []string
+		for _, r := range routes[params[3]] {
+			if r != target {
+				newRooms = append(newRooms, r)
+			}
+		}
+		if len(newRooms) == 0 {
+			delete(routes, params[3])
+		} else {
+			routes[params[3]] = newRooms
+		}
+		saveGithubRoutes(routes)
+		client.SendMessage(roomID, formatGithubRoutes(routes))
+	default:
+		client.SendMessage(roomID, "Usage: !webhook github [route/unroute/list] <...>")
+	}
+}
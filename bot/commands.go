@@ -0,0 +1,112 @@
+package bot
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"time"
+)
+
+// commandContext is the message that invoked a command
+type commandContext struct {
+	roomID        string
+	sender        string
+	msg           string
+	format        string
+	formattedBody string
+	replyTo       string
+}
+
+type command struct {
+	name         string
+	usage        string
+	description  string
+	permission   string        // empty for commands anyone can use, otherwise one of the permissions of hasPermission
+	userCooldown time.Duration // minimum time between uses by the same user
+	roomCooldown time.Duration // minimum time between uses in the same room
+	handler      func(ctx commandContext)
+}
+
+var commands map[string]command
+
+// initCommands builds the command registry, every chat command and its help text is defined here. The handlers of the
+// commands are wrapped in the commandMiddlewares
+func initCommands() {
+	commands = make(map[string]command)
+	for _, c := range []command{
+		{name: "!help", usage: "!help [command]", description: "lists the commands or shows the usage of one",
+			handler: func(ctx commandContext) { help(ctx.roomID, ctx.msg) }},
+		{name: "!ping", usage: "!ping [-6] <host> [count]", description: "pings a host", userCooldown: 10 * time.Second,
+			handler: func(ctx commandContext) { ping(ctx.roomID, ctx.msg) }},
+		{name: "!traceroute", usage: "!traceroute [-6] <host>", description: "traces the route to a host", userCooldown: 30 * time.Second, roomCooldown: 10 * time.Second,
+			handler: func(ctx commandContext) { traceroute(ctx.roomID, ctx.msg) }},
+		{name: "!ruuvi", usage: "!ruuvi [- [interval] [duration]|query|graph|alert|config|add|remove] <...>", description: "shows ruuvi sensor data, manages endpoints and alerts",
+			handler: func(ctx commandContext) { ruuvi(ctx.roomID, ctx.sender, ctx.msg) }},
+		{name: "!grafana", usage: "!grafana <template-name> [- [interval] [duration]], or !grafana help", description: "shows and manages Grafana templates",
+			handler: func(ctx commandContext) { grafana(ctx.roomID, ctx.sender, ctx.msg) }},
+		{name: "!remind", usage: "!remind <time, date, datetime, duration, sunrise or sunset> <message>, or !remind [list/cancel/confirm/location]", description: "sets and manages reminders",
+			handler: func(ctx commandContext) { remind(ctx.roomID, ctx.sender, ctx.msg, ctx.format, ctx.formattedBody) }},
+		{name: "!snooze", usage: "!snooze [duration] as a reply to a reminder", description: "reminds again after the duration, 10m by default",
+			handler: func(ctx commandContext) { snooze(ctx.roomID, ctx.sender, ctx.msg, ctx.replyTo) }},
+		{name: "!streaming", usage: "!streaming [interval duration]", description: "shows or sets how live updating messages refresh in this room",
+			handler: func(ctx commandContext) { streaming(ctx.roomID, ctx.sender, ctx.msg) }},
+		{name: "!jobs", usage: "!jobs", description: "lists the background jobs and their state", permission: "admin",
+			handler: func(ctx commandContext) { jobs(ctx.roomID) }},
+		{name: "!quiethours", usage: "!quiethours [<start>-<end>/off]", description: "shows or sets the quiet hours of this room",
+			handler: func(ctx commandContext) { quiethours(ctx.roomID, ctx.sender, ctx.msg) }},
+		{name: "!apitoken", usage: "!apitoken [create/revoke/list] <...>", description: "manages the tokens of the HTTP API", permission: "admin",
+			handler: func(ctx commandContext) { apitoken(ctx.roomID, ctx.msg) }},
+		{name: "!webhook", usage: "!webhook [grafana/alertmanager/github] <...>", description: "manages the inbound webhooks", permission: "admin",
+			handler: func(ctx commandContext) { webhook(ctx.roomID, ctx.msg) }},
+		{name: "!poll", usage: "!poll \"<question>\" <option> <option> [option ...], or !poll close", description: "runs a poll voted on with reactions",
+			handler: func(ctx commandContext) { pollCommand(ctx.roomID, ctx.sender, ctx.msg) }},
+		{name: "!config", usage: "!config [get/set/unset] <setting> [value]", description: "shows and changes the settings of this room", permission: "admin",
+			handler: func(ctx commandContext) { config(ctx.roomID, ctx.msg) }},
+	} {
+		for i := len(commandMiddlewares) - 1; i >= 0; i-- {
+			c.handler = commandMiddlewares[i](c, c.handler)
+		}
+		commands[c.name] = c
+	}
+}
+
+func formatCommandPermission(c command) string {
+	switch c.permission {
+	case "admin":
+		return " <font color=\"gray\">(admin only)</font>"
+	case "grafana":
+		return " <font color=\"gray\">(authorized users only)</font>"
+	case "moderator":
+		return " <font color=\"gray\">(room moderators only)</font>"
+	default:
+		return ""
+	}
+}
+
+func help(roomID, msg string) {
+	params := strings.Split(msg, " ")
+	if len(params) > 1 {
+		name := params[1]
+		if !strings.HasPrefix(name, "!") {
+			name = "!" + name
+		}
+		c, ok := commands[name]
+		if !ok {
+			client.SendMessage(roomID, "Unknown command: "+name)
+			return
+		}
+		client.SendFormattedMessage(roomID, "<b>"+html.EscapeString(c.usage)+"</b><br>"+c.description+formatCommandPermission(c))
+		return
+	}
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var lines []string
+	for _, name := range names {
+		c := commands[name]
+		lines = append(lines, "<li><b>"+name+"</b>: "+c.description+formatCommandPermission(c)+"</li>")
+	}
+	client.SendFormattedMessage(roomID, "Commands:<ul>"+strings.Join(lines, "")+"</ul>Use <b>!help &lt;command></b> for the usage of a command")
+}
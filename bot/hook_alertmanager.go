@@ -0,0 +1,254 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type alertmanagerRoute struct {
+	ID       int64                 `json:"id"`
+	RoomID   string                `json:"room_id"`
+	Matchers []alertmanagerMatcher `json:"matchers"`
+}
+
+type alertmanagerMatcher struct {
+	Label string `json:"label"`
+	Op    string `json:"op"`
+	Value string `json:"value"`
+}
+
+var alertmanagerRoutesLock sync.Mutex
+
+func getAlertmanagerRoutes() []alertmanagerRoute {
+	routesJson := db.Get("alertmanager_routes")
+	var routes []alertmanagerRoute
+	if routesJson != "" {
+		json.Unmarshal([]byte(routesJson), &routes)
+	}
+	return routes
+}
+
+func saveAlertmanagerRoutes(routes []alertmanagerRoute) {
+	res, err := json.Marshal(routes)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	db.Set("alertmanager_routes", string(res))
+}
+
+// updateAlertmanagerRoutes atomically replaces the stored routes with the result of update
+func updateAlertmanagerRoutes(update func([]alertmanagerRoute) []alertmanagerRoute) {
+	alertmanagerRoutesLock.Lock()
+	defer alertmanagerRoutesLock.Unlock()
+	saveAlertmanagerRoutes(update(getAlertmanagerRoutes()))
+}
+
+// nextAlertmanagerRouteID must be called with alertmanagerRoutesLock held
+func nextAlertmanagerRouteID() int64 {
+	id, _ := strconv.ParseInt(db.Get("alertmanager_route_next_id"), 10, 64)
+	if id < 1 {
+		id = 1
+	}
+	db.Set("alertmanager_route_next_id", strconv.FormatInt(id+1, 10))
+	return id
+}
+
+// parseAlertmanagerMatcher parses a matcher in the Alertmanager syntax: label=value, label!=value, label=~regex or
+// label!~regex
+func parseAlertmanagerMatcher(s string) (alertmanagerMatcher, error) {
+	for _, op := range []string{"!=", "=~", "!~", "="} {
+		if i := strings.Index(s, op); i > 0 {
+			m := alertmanagerMatcher{s[:i], op, strings.Trim(s[i+len(op):], `"`)}
+			if op == "=~" || op == "!~" {
+				if _, err := regexp.Compile("^(?:" + m.Value + ")$"); err != nil {
+					return m, err
+				}
+			}
+			return m, nil
+		}
+	}
+	return alertmanagerMatcher{}, errors.New("Invalid matcher: " + s)
+}
+
+func (m alertmanagerMatcher) String() string {
+	return m.Label + m.Op + `"` + m.Value + `"`
+}
+
+func (m alertmanagerMatcher) matches(labels map[string]string) bool {
+	value := labels[m.Label]
+	switch m.Op {
+	case "=":
+		return value == m.Value
+	case "!=":
+		return value != m.Value
+	case "=~", "!~":
+		re, err := regexp.Compile("^(?:" + m.Value + ")$")
+		if err != nil {
+			return false
+		}
+		return re.MatchString(value) == (m.Op == "=~")
+	default:
+		return false
+	}
+}
+
+func (r alertmanagerRoute) matches(labels map[string]string) bool {
+	for _, m := range r.Matchers {
+		if !m.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func formatAlertmanagerRoute(r alertmanagerRoute) string {
+	var matchers []string
+	for _, m := range r.Matchers {
+		matchers = append(matchers, m.String())
+	}
+	return "#" + strconv.FormatInt(r.ID, 10) + " {" + strings.Join(matchers, ", ") + "} -> " + r.RoomID
+}
+
+// routeAlertmanagerPayload splits the alerts of the payload to the rooms of the routes matching them, an alert is
+// posted to every room with a matching route
+func routeAlertmanagerPayload(payload alertmanagerPayload) map[string]alertmanagerPayload {
+	routed := make(map[string]alertmanagerPayload)
+	for _, r := range getAlertmanagerRoutes() {
+		for _, a := range payload.Alerts {
+			if !r.matches(a.Labels) {
+				continue
+			}
+			p, ok := routed[r.RoomID]
+			if !ok {
+				p = payload
+				p.Alerts = nil
+				p.Status = "resolved"
+			}
+			if containsAlert(p.Alerts, a) {
+				continue
+			}
+			if a.Status == "firing" {
+				p.Status = "firing"
+			}
+			p.Alerts = append(p.Alerts, a)
+			routed[r.RoomID] = p
+		}
+	}
+	return routed
+}
+
+func containsAlert(alerts []alertmanagerAlert, alert alertmanagerAlert) bool {
+	for _, a := range alerts {
+		if a.Fingerprint != "" && a.Fingerprint == alert.Fingerprint {
+			return true
+		}
+	}
+	return false
+}
+
+// alertmanagerWebhookHandler receives Alertmanager notifications with POST /api/webhooks/alertmanager and posts them to
+// the rooms of the matching routes that the API token is authorized for
+func alertmanagerWebhookHandler(w http.ResponseWriter, req *http.Request) {
+	metrics.webhooksHandled.With(prometheus.Labels{"hook": "alertmanager"}).Inc()
+	if req.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	token, ok := authenticateAPIRequest(req)
+	if !ok {
+		writeAPIError(w, http.StatusUnauthorized, "invalid or missing token")
+		return
+	}
+	if !allowAPIRequest(token.Name) {
+		w.Header().Set("Retry-After", "60")
+		writeAPIError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		return
+	}
+	var payload alertmanagerPayload
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	routed := routeAlertmanagerPayload(payload)
+	var rooms []string
+	for roomID, p := range routed {
+		if !token.allowsRoom(roomID) {
+			continue
+		}
+		rooms = append(rooms, roomID)
+		go postAlertmanagerNotification(roomID, p)
+	}
+	sort.Strings(rooms)
+	writeAPIResponse(w, http.StatusOK, struct {
+		Rooms []string `json:"rooms"`
+	}{rooms})
+}
+
+func alertmanagerRouteCommand(roomID string, params []string) {
+	switch params[2] {
+	case "list":
+		respLines := []string{"Current Alertmanager routes: "}
+		for _, r := range getAlertmanagerRoutes() {
+			respLines = append(respLines, formatAlertmanagerRoute(r))
+		}
+		client.SendMessage(roomID, strings.Join(respLines, "\n"))
+	case "add":
+		if len(params) < 4 {
+			client.SendMessage(roomID, "Usage: !webhook alertmanager add <matcher> [matcher ...], for example !webhook alertmanager add severity=~\"critical|warning\" team=infra")
+			return
+		}
+		route := alertmanagerRoute{RoomID: roomID}
+		for _, s := range params[3:] {
+			m, err := parseAlertmanagerMatcher(s)
+			if err != nil {
+				client.SendMessage(roomID, err.Error())
+				return
+			}
+			route.Matchers = append(route.Matchers, m)
+		}
+		updateAlertmanagerRoutes(func(routes []alertmanagerRoute) []alertmanagerRoute {
+			route.ID = nextAlertmanagerRouteID()
+			return append(routes, route)
+		})
+		client.SendMessage(roomID, "Added route "+formatAlertmanagerRoute(route))
+	case "remove":
+		if len(params) < 4 {
+			client.SendMessage(roomID, "Usage: !webhook alertmanager remove <id>")
+			return
+		}
+		id, err := strconv.ParseInt(strings.TrimPrefix(params[3], "#"), 10, 64)
+		if err != nil {
+			client.SendMessage(roomID, "Invalid route ID: "+params[3])
+			return
+		}
+		removed := false
+		updateAlertmanagerRoutes(func(routes []alertmanagerRoute) []alertmanagerRoute {
+			var newRoutes []alertmanagerRoute
+			for _, r := range routes {
+				if r.ID == id {
+					removed = true
+					continue
+				}
+				newRoutes = append(newRoutes, r)
+			}
+			return newRoutes
+		})
+		if !removed {
+			client.SendMessage(roomID, "Route #"+strconv.FormatInt(id, 10)+" not found")
+			return
+		}
+		client.SendMessage(roomID, "Removed route #"+strconv.FormatInt(id, 10))
+	default:
+		client.SendMessage(roomID, "Usage: !webhook alertmanager [add/remove/list] <...>")
+	}
+}
@@ -0,0 +1,222 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"html"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const maxCustomWebhookPayload = 64 * 1024
+
+type customWebhook struct {
+	ID        string `json:"id"`
+	TokenHash string `json:"token_hash"`
+	RoomID    string `json:"room_id"`
+	Template  string `json:"template"`
+	Creator   string `json:"creator"`
+}
+
+type customWebhookRequest struct {
+	RoomID   string `json:"room_id"`
+	Template string `json:"template"`
+}
+
+var customWebhooksLock sync.Mutex
+
+func getCustomWebhooks() []customWebhook {
+	webhooksJson := db.Get("custom_webhooks")
+	var webhooks []customWebhook
+	if webhooksJson != "" {
+		json.Unmarshal([]byte(webhooksJson), &webhooks)
+	}
+	return webhooks
+}
+
+func saveCustomWebhooks(webhooks []customWebhook) {
+	res, err := json.Marshal(webhooks)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	db.Set("custom_webhooks", string(res))
+}
+
+// updateCustomWebhooks atomically replaces the stored webhooks with the result of update
+func updateCustomWebhooks(update func([]customWebhook) []customWebhook) {
+	customWebhooksLock.Lock()
+	defer customWebhooksLock.Unlock()
+	saveCustomWebhooks(update(getCustomWebhooks()))
+}
+
+// formatCustomWebhookPayload renders the payload with the template of the webhook. The template is an html/template,
+// so values from the payload are escaped. Without a template the payload is shown as indented JSON
+func formatCustomWebhookPayload(webhook customWebhook, payload interface{}) (string, error) {
+	if webhook.Template == "" {
+		res, err := json.MarshalIndent(payload, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return "<pre><code>" + html.EscapeString(string(res)) + "</code></pre>", nil
+	}
+	tmpl, err := template.New("").Parse(webhook.Template)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, payload); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// customWebhookHandler receives arbitrary JSON payloads with POST /api/webhooks/custom/{token} and posts them to the
+// room of the webhook
+func customWebhookHandler(w http.ResponseWriter, req *http.Request) {
+	metrics.webhooksHandled.With(prometheus.Labels{"hook": "custom"}).Inc()
+	token := strings.TrimPrefix(req.URL.Path, "/api/webhooks/custom/")
+	if token == "" {
+		customWebhookManagementHandler(w, req)
+		return
+	}
+	if req.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	hash := hashAPIToken(token)
+	var webhook customWebhook
+	found := false
+	for _, wh := range getCustomWebhooks() {
+		if wh.TokenHash == hash {
+			webhook, found = wh, true
+			break
+		}
+	}
+	if !found {
+		writeAPIError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if !allowAPIRequest("custom webhook " + webhook.ID) {
+		w.Header().Set("Retry-After", "60")
+		writeAPIError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		return
+	}
+	var payload interface{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxCustomWebhookPayload)).Decode(&payload); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	msg, err := formatCustomWebhookPayload(webhook, payload)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if strings.TrimSpace(msg) == "" {
+		writeAPIResponse(w, http.StatusOK, struct{}{})
+		return
+	}
+	eventID, ok := sendAPIMessage(webhook.RoomID, apiMessageRequest{Body: msg, Format: "html", MsgType: "m.notice"})
+	if !ok {
+		writeAPIError(w, http.StatusBadGateway, "failed to send the message")
+		return
+	}
+	writeAPIResponse(w, http.StatusOK, struct {
+		EventID string `json:"event_id"`
+	}{eventID})
+}
+
+// customWebhookManagementHandler manages custom webhooks with an API token at /api/webhooks/custom/:
+// GET lists the webhooks of the rooms the token is authorized for, POST creates a webhook and returns its secret
+// token, and DELETE ?id=<id> removes a webhook
+func customWebhookManagementHandler(w http.ResponseWriter, req *http.Request) {
+	auth, ok := authenticateAPIRequest(req)
+	if !ok {
+		writeAPIError(w, http.StatusUnauthorized, "invalid or missing token")
+		return
+	}
+	if !allowAPIRequest(auth.Name) {
+		w.Header().Set("Retry-After", "60")
+		writeAPIError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		return
+	}
+	type webhookResponse struct {
+		ID       string `json:"id"`
+		RoomID   string `json:"room_id"`
+		Template string `json:"template"`
+		Token    string `json:"token,omitempty"`
+	}
+	switch req.Method {
+	case http.MethodGet:
+		webhooks := []webhookResponse{}
+		for _, wh := range getCustomWebhooks() {
+			if auth.allowsRoom(wh.RoomID) {
+				webhooks = append(webhooks, webhookResponse{wh.ID, wh.RoomID, wh.Template, ""})
+			}
+		}
+		writeAPIResponse(w, http.StatusOK, webhooks)
+	case http.MethodPost:
+		var body customWebhookRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !auth.allowsRoom(body.RoomID) {
+			writeAPIError(w, http.StatusForbidden, "token is not authorized for room "+body.RoomID)
+			return
+		}
+		if _, err := template.New("").Parse(body.Template); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid template: "+err.Error())
+			return
+		}
+		id, err := newAPIToken()
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		token, err := newAPIToken()
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		webhook := customWebhook{id[:12], hashAPIToken(token), body.RoomID, body.Template, auth.Name}
+		updateCustomWebhooks(func(webhooks []customWebhook) []customWebhook {
+			return append(webhooks, webhook)
+		})
+		writeAPIResponse(w, http.StatusCreated, webhookResponse{webhook.ID, webhook.RoomID, webhook.Template, token})
+	case http.MethodDelete:
+		id := req.URL.Query().Get("id")
+		removed, forbidden := false, false
+		updateCustomWebhooks(func(webhooks []customWebhook) []customWebhook {
+			var newWebhooks []customWebhook
+			for _, wh := range webhooks {
+				if wh.ID == id {
+					if !auth.allowsRoom(wh.RoomID) {
+						forbidden = true
+					} else {
+						removed = true
+						continue
+					}
+				}
+				newWebhooks = append(newWebhooks, wh)
+			}
+			return newWebhooks
+		})
+		if forbidden {
+			writeAPIError(w, http.StatusForbidden, "token is not authorized for the room of webhook "+id)
+			return
+		}
+		if !removed {
+			writeAPIError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeAPIResponse(w, http.StatusOK, struct{}{})
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
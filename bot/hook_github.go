@@ -3,9 +3,11 @@ package bot
 import (
 	"crypto/hmac"
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"html"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -42,6 +44,16 @@ type GithubPayload struct {
 		HtmlUrl string `json:"html_url"`
 		Title   string `json:"title"`
 	} `json:"pull_request"`
+	Issue struct {
+		HtmlUrl string `json:"html_url"`
+		Title   string `json:"title"`
+		Number  int    `json:"number"`
+	} `json:"issue"`
+	Release struct {
+		HtmlUrl string `json:"html_url"`
+		TagName string `json:"tag_name"`
+		Name    string `json:"name"`
+	} `json:"release"`
 	Hook struct {
 		Type string `json:"type"`
 	} `json:"hook"`
@@ -50,16 +62,45 @@ type GithubPayload struct {
 	} `json:"sender"`
 }
 
-func sendGithubMsg(payload GithubPayload, roomID string) {
-	if payload.Hook.Type == "Repository" {
+func getGithubRoutes() map[string][]string {
+	routesJson := db.Get("github_routes")
+	var routes map[string][]string
+	if routesJson != "" {
+		json.Unmarshal([]byte(routesJson), &routes)
+	}
+	if routes == nil {
+		routes = make(map[string][]string)
+	}
+	return routes
+}
+
+func saveGithubRoutes(routes map[string][]string) {
+	res, err := json.Marshal(routes)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	db.Set("github_routes", string(res))
+}
+
+// sendGithubMsg sends a notice of the event to the room, returning false without sending anything for event types
+// that are not handled
+func sendGithubMsg(event string, payload GithubPayload, roomID string) bool {
+	switch {
+	case event == "ping" || payload.Hook.Type == "Repository":
 		sendGithubHookConfig(payload, roomID)
-	} else if payload.Pusher.Name != "" {
+	case event == "push" || (event == "" && payload.Pusher.Name != ""):
 		sendGithubPush(payload, roomID)
-	} else if payload.PullRequest.HtmlUrl != "" {
+	case event == "pull_request" || (event == "" && payload.PullRequest.HtmlUrl != ""):
 		sendGithubPullrequest(payload, roomID)
-	} else {
-		client.SendNotice(roomID, "Unknown github hook called")
+	case event == "issues":
+		sendGithubIssue(payload, roomID)
+	case event == "release":
+		sendGithubRelease(payload, roomID)
+	default:
+		return false
 	}
+	return true
 }
 
 func sendGithubHookConfig(payload GithubPayload, roomID string) {
@@ -73,6 +114,25 @@ func sendGithubPullrequest(payload GithubPayload, roomID string) {
 		"<font color=\"#7F0000\">"+payload.PullRequest.Title+"</font>")
 }
 
+func sendGithubIssue(payload GithubPayload, roomID string) {
+	client.SendFormattedNotice(roomID, "[<font color=\"#0000FC\">"+payload.Repository.FullName+"</font>] "+
+		"<font color=\"#9C009C\">"+html.EscapeString(payload.Sender.Login)+"</font> <a href=\""+payload.Issue.HtmlUrl+"\">"+payload.Action+" issue #"+strconv.Itoa(payload.Issue.Number)+":</a> "+
+		"<font color=\"#7F0000\">"+html.EscapeString(payload.Issue.Title)+"</font>")
+}
+
+func sendGithubRelease(payload GithubPayload, roomID string) {
+	if payload.Action != "published" {
+		return
+	}
+	name := payload.Release.Name
+	if name == "" {
+		name = payload.Release.TagName
+	}
+	client.SendFormattedNotice(roomID, "[<font color=\"#0000FC\">"+payload.Repository.FullName+"</font>] "+
+		"<font color=\"#9C009C\">"+html.EscapeString(payload.Sender.Login)+"</font> <a href=\""+payload.Release.HtmlUrl+"\">published a release:</a> "+
+		"<font color=\"#7F0000\">"+html.EscapeString(name)+"</font>")
+}
+
 func sendGithubPush(payload GithubPayload, roomID string) {
 	nullCommit := "0000000000000000000000000000000000000000"
 	if payload.AfterCommit == nullCommit {
@@ -105,6 +165,22 @@ func sendGithubPush(payload GithubPayload, roomID string) {
 	client.SendFormattedNotice(roomID, strings.Join(output, "<br />"))
 }
 
+// verifySignature256 verifies the sha256 HMAC signature of the X-Hub-Signature-256 header
+func verifySignature256(secret []byte, signature string, body []byte) bool {
+	const signaturePrefix = "sha256="
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return false
+	}
+	actual, err := hex.DecodeString(signature[len(signaturePrefix):])
+	if err != nil {
+		return false
+	}
+
+	computed := hmac.New(sha256.New, secret)
+	computed.Write(body)
+	return hmac.Equal(computed.Sum(nil), actual)
+}
+
 func verifySignature(secret []byte, signature string, body []byte) bool {
 
 	const signaturePrefix = "sha1="
@@ -126,8 +202,9 @@ func githubHandler(hookSecret string) func(w http.ResponseWriter, req *http.Requ
 	labels := prometheus.Labels{"hook": "github"}
 	return func(w http.ResponseWriter, req *http.Request) {
 		metrics.webhooksHandled.With(labels).Inc()
+		signature256 := req.Header.Get("x-hub-signature-256")
 		signature := req.Header.Get("x-hub-signature")
-		if signature == "" {
+		if signature == "" && signature256 == "" {
 			return
 		}
 
@@ -138,21 +215,30 @@ func githubHandler(hookSecret string) func(w http.ResponseWriter, req *http.Requ
 		}
 		req.Body.Close()
 
-		if !verifySignature([]byte(hookSecret), signature, body) {
+		if signature256 != "" && !verifySignature256([]byte(hookSecret), signature256, body) ||
+			signature256 == "" && !verifySignature([]byte(hookSecret), signature, body) {
 			log.Print("Invalid signature")
 			return
 		}
 
-		roomID := req.URL.Query().Get("room_id")
-		if roomID == "" {
-			return
-		}
 		msg := GithubPayload{}
 		err = json.Unmarshal(body, &msg)
 		if err != nil {
 			fmt.Fprintf(w, "%v", err)
 			return
 		}
-		sendGithubMsg(msg, roomID)
+		// an explicit room takes precedence over the routes configured for the repository
+		rooms := getGithubRoutes()[msg.Repository.FullName]
+		if roomID := req.URL.Query().Get("room_id"); roomID != "" {
+			rooms = []string{roomID}
+		}
+		event := req.Header.Get("x-github-event")
+		for _, roomID := range rooms {
+			if !sendGithubMsg(event, msg, roomID) {
+				log.Print("Ignoring unhandled github event " + event + " of " + msg.Repository.FullName)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
 	}
 }
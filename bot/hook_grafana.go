@@ -0,0 +1,115 @@
+package bot
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type grafanaWebhook struct {
+	Name       string `json:"name"`
+	SecretHash string `json:"secret_hash"`
+	RoomID     string `json:"room_id"`
+}
+
+func getGrafanaWebhooks() []grafanaWebhook {
+	webhooksJson := db.Get("grafana_webhooks")
+	var webhooks []grafanaWebhook
+	if webhooksJson != "" {
+		json.Unmarshal([]byte(webhooksJson), &webhooks)
+	}
+	return webhooks
+}
+
+func saveGrafanaWebhooks(webhooks []grafanaWebhook) {
+	res, err := json.Marshal(webhooks)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	db.Set("grafana_webhooks", string(res))
+}
+
+func findGrafanaWebhook(name string) (grafanaWebhook, bool) {
+	for _, w := range getGrafanaWebhooks() {
+		if w.Name == name {
+			return w, true
+		}
+	}
+	return grafanaWebhook{}, false
+}
+
+// grafanaWebhookHandler receives Grafana alerts with POST /api/webhooks/grafana/{name}, authenticated with the secret
+// of the webhook as a bearer token. The room of a webhook can be changed with PUT /api/webhooks/grafana/{name} using
+// an API token that is authorized for both the current and the new room
+func grafanaWebhookHandler(w http.ResponseWriter, req *http.Request) {
+	metrics.webhooksHandled.With(prometheus.Labels{"hook": "grafana"}).Inc()
+	name := strings.TrimPrefix(req.URL.Path, "/api/webhooks/grafana/")
+	webhook, ok := findGrafanaWebhook(name)
+	if name == "" || !ok {
+		writeAPIError(w, http.StatusNotFound, "not found")
+		return
+	}
+	switch req.Method {
+	case http.MethodPost:
+		auth := req.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") || hashAPIToken(strings.TrimPrefix(auth, "Bearer ")) != webhook.SecretHash {
+			writeAPIError(w, http.StatusUnauthorized, "invalid or missing secret")
+			return
+		}
+		if !allowAPIRequest("grafana webhook " + webhook.Name) {
+			w.Header().Set("Retry-After", "60")
+			writeAPIError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		// the payload of Grafana webhook contact points is a superset of the Alertmanager webhook payload
+		var payload alertmanagerPayload
+		if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		go postAlertmanagerNotification(webhook.RoomID, payload)
+		writeAPIResponse(w, http.StatusOK, struct{}{})
+	case http.MethodPut:
+		token, ok := authenticateAPIRequest(req)
+		if !ok {
+			writeAPIError(w, http.StatusUnauthorized, "invalid or missing token")
+			return
+		}
+		var body struct {
+			RoomID string `json:"room_id"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !token.allowsRoom(body.RoomID) {
+			writeAPIError(w, http.StatusForbidden, "token is not authorized for room "+body.RoomID)
+			return
+		}
+		// moving a webhook takes its alerts away from its current room, so that room must be allowed too
+		if !token.allowsRoom(webhook.RoomID) {
+			writeAPIError(w, http.StatusForbidden, "token is not authorized for room "+webhook.RoomID)
+			return
+		}
+		routeGrafanaWebhook(webhook.Name, body.RoomID)
+		writeAPIResponse(w, http.StatusOK, struct {
+			RoomID string `json:"room_id"`
+		}{body.RoomID})
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func routeGrafanaWebhook(name, roomID string) {
+	webhooks := getGrafanaWebhooks()
+	for i := range webhooks {
+		if webhooks[i].Name == name {
+			webhooks[i].RoomID = roomID
+		}
+	}
+	saveGrafanaWebhooks(webhooks)
+}
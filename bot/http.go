@@ -8,6 +8,12 @@ import (
 
 func initHTTP(hookSecret string) {
 	http.HandleFunc("/hooks/github", githubHandler(hookSecret))
+	http.HandleFunc("/api/webhooks/github", githubHandler(hookSecret))
+	http.HandleFunc("/api/rooms/", apiMessageHandler)
+	http.HandleFunc("/api/alertmanager/", alertmanagerHandler)
+	http.HandleFunc("/api/webhooks/grafana/", grafanaWebhookHandler)
+	http.HandleFunc("/api/webhooks/alertmanager", alertmanagerWebhookHandler)
+	http.HandleFunc("/api/webhooks/custom/", customWebhookHandler)
 	http.Handle("/metrics", promhttp.Handler())
 	go http.ListenAndServe(":8080", nil)
 }
@@ -6,6 +6,8 @@ var metrics struct {
 	webhooksHandled *prometheus.CounterVec
 	eventsHandled   *prometheus.CounterVec
 	commandsHandled *prometheus.CounterVec
+	commandDuration *prometheus.HistogramVec
+	outboundQueue   prometheus.GaugeFunc
 }
 
 func initMetrics() {
@@ -23,7 +25,22 @@ func initMetrics() {
 		Help: "Total number of chat commands handled",
 	}, []string{"command"})
 
+	metrics.commandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    metricPrefix + "command_duration_seconds",
+		Help:    "Time spent handling chat commands, not including work the command continues in the background",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 8),
+	}, []string{"command"})
+	metrics.outboundQueue = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: metricPrefix + "outbound_queue_length",
+		Help: "Number of events waiting in the Matrix send queue",
+	}, func() float64 {
+		length, _ := client.OutboundQueueLength()
+		return float64(length)
+	})
+
 	prometheus.MustRegister(metrics.webhooksHandled)
 	prometheus.MustRegister(metrics.eventsHandled)
 	prometheus.MustRegister(metrics.commandsHandled)
+	prometheus.MustRegister(metrics.commandDuration)
+	prometheus.MustRegister(metrics.outboundQueue)
 }
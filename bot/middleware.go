@@ -0,0 +1,105 @@
+package bot
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// moderatorPowerLevel is the room power level at which users count as room moderators
+const moderatorPowerLevel = 50
+
+// commandMiddleware wraps the handler of a command, commandMiddlewares are applied to every registered command in order
+type commandMiddleware func(c command, next func(ctx commandContext)) func(ctx commandContext)
+
+var commandMiddlewares = []commandMiddleware{metricsMiddleware, permissionMiddleware, cooldownMiddleware}
+
+var commandCooldowns = struct {
+	sync.Mutex
+	lastUse map[string]time.Time
+}{lastUse: make(map[string]time.Time)}
+
+// hasPermission returns whether the sender has the given permission in the room. Admins are moderators of every room
+func hasPermission(roomID, sender, permission string) bool {
+	switch permission {
+	case "":
+		return true
+	case "admin":
+		return sender == adminUser
+	case "grafana":
+		return validUser(sender)
+	case "moderator":
+		return sender == adminUser || client.PowerLevel(roomID, sender) >= moderatorPowerLevel
+	default:
+		return false
+	}
+}
+
+// checkPermission is like hasPermission, but also tells the sender when they lack the permission
+func checkPermission(roomID, sender, permission string) bool {
+	if hasPermission(roomID, sender, permission) {
+		return true
+	}
+	switch permission {
+	case "admin":
+		client.SendMessage(roomID, "Only admins can use this command")
+	case "grafana":
+		client.SendMessage(roomID, "Only authorized users can use this command")
+	case "moderator":
+		client.SendMessage(roomID, "Only room moderators can use this command")
+	default:
+		client.SendMessage(roomID, "You are not allowed to use this command")
+	}
+	return false
+}
+
+func metricsMiddleware(c command, next func(ctx commandContext)) func(ctx commandContext) {
+	labels := prometheus.Labels{"command": c.name}
+	return func(ctx commandContext) {
+		start := time.Now()
+		next(ctx)
+		metrics.commandDuration.With(labels).Observe(time.Since(start).Seconds())
+		metrics.commandsHandled.With(labels).Inc()
+	}
+}
+
+func permissionMiddleware(c command, next func(ctx commandContext)) func(ctx commandContext) {
+	if c.permission == "" {
+		return next
+	}
+	return func(ctx commandContext) {
+		if checkPermission(ctx.roomID, ctx.sender, c.permission) {
+			next(ctx)
+		}
+	}
+}
+
+// cooldownMiddleware limits how often a command can be used by the same user and in the same room. Admins are exempt
+func cooldownMiddleware(c command, next func(ctx commandContext)) func(ctx commandContext) {
+	if c.userCooldown == 0 && c.roomCooldown == 0 {
+		return next
+	}
+	return func(ctx commandContext) {
+		if ctx.sender != adminUser {
+			userKey, roomKey := c.name+"|user|"+ctx.sender, c.name+"|room|"+ctx.roomID
+			now := time.Now()
+			commandCooldowns.Lock()
+			wait := c.userCooldown - now.Sub(commandCooldowns.lastUse[userKey])
+			if roomWait := c.roomCooldown - now.Sub(commandCooldowns.lastUse[roomKey]); roomWait > wait {
+				wait = roomWait
+			}
+			if wait <= 0 {
+				commandCooldowns.lastUse[userKey] = now
+				commandCooldowns.lastUse[roomKey] = now
+			}
+			commandCooldowns.Unlock()
+			if wait > 0 {
+				client.SendMessage(ctx.roomID, "Please wait "+strconv.Itoa(int(wait.Seconds())+1)+"s before using "+c.name+" again")
+				return
+			}
+		}
+		next(ctx)
+	}
+}
@@ -0,0 +1,230 @@
+package bot
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var naturalWeekdays = map[string]time.Weekday{
+	"monday":        time.Monday,
+	"tuesday":       time.Tuesday,
+	"wednesday":     time.Wednesday,
+	"thursday":      time.Thursday,
+	"friday":        time.Friday,
+	"saturday":      time.Saturday,
+	"sunday":        time.Sunday,
+	"maanantai":     time.Monday,
+	"maanantaina":   time.Monday,
+	"tiistai":       time.Tuesday,
+	"tiistaina":     time.Tuesday,
+	"keskiviikko":   time.Wednesday,
+	"keskiviikkona": time.Wednesday,
+	"torstai":       time.Thursday,
+	"torstaina":     time.Thursday,
+	"perjantai":     time.Friday,
+	"perjantaina":   time.Friday,
+	"lauantai":      time.Saturday,
+	"lauantaina":    time.Saturday,
+	"sunnuntai":     time.Sunday,
+	"sunnuntaina":   time.Sunday,
+}
+
+// naturalTimesOfDay are named times of day as hours since midnight
+var naturalTimesOfDay = map[string]int{
+	"midnight":      0,
+	"keskiyö":       0,
+	"keskiyöllä":    0,
+	"morning":       9,
+	"aamulla":       9,
+	"noon":          12,
+	"keskipäivä":    12,
+	"keskipäivällä": 12,
+	"afternoon":     15,
+	"iltapäivällä":  15,
+	"evening":       18,
+	"illalla":       18,
+}
+
+type naturalUnit struct {
+	duration            time.Duration
+	years, months, days int
+}
+
+var naturalUnits = map[string]naturalUnit{
+	"minute":    {duration: time.Minute},
+	"minutes":   {duration: time.Minute},
+	"min":       {duration: time.Minute},
+	"mins":      {duration: time.Minute},
+	"minuutti":  {duration: time.Minute},
+	"minuutin":  {duration: time.Minute},
+	"hour":      {duration: time.Hour},
+	"hours":     {duration: time.Hour},
+	"tunti":     {duration: time.Hour},
+	"tunnin":    {duration: time.Hour},
+	"day":       {days: 1},
+	"days":      {days: 1},
+	"päivä":     {days: 1},
+	"päivän":    {days: 1},
+	"week":      {days: 7},
+	"weeks":     {days: 7},
+	"viikko":    {days: 7},
+	"viikon":    {days: 7},
+	"month":     {months: 1},
+	"months":    {months: 1},
+	"kuukausi":  {months: 1},
+	"kuukauden": {months: 1},
+	"year":      {years: 1},
+	"years":     {years: 1},
+	"vuosi":     {years: 1},
+	"vuoden":    {years: 1},
+}
+
+// remindNaturalTime parses a natural language time phrase from the beginning of words, such as "tomorrow at noon",
+// "next friday 17:30", "in 2 weeks" or "ensi perjantaina klo 17". Both English and Finnish words are understood.
+//
+// Returns the parsed time and the number of words the phrase consisted of
+func remindNaturalTime(now time.Time, words []string) (time.Time, int, error) {
+	loc, _ := time.LoadLocation(timezone)
+	now = now.In(loc)
+	word := func(i int) string {
+		if i >= len(words) {
+			return ""
+		}
+		return strings.ToLower(words[i])
+	}
+
+	// relative times: "in 2 weeks" and "2 viikon päästä"
+	if word(0) == "in" {
+		if t, ok := addNaturalUnits(now, word(1), word(2)); ok {
+			return t, 3, nil
+		}
+	}
+	if word(2) == "päästä" {
+		if t, ok := addNaturalUnits(now, word(0), word(1)); ok {
+			return t, 3, nil
+		}
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	var day time.Time
+	hasDay, weekday, strictWeekday := false, false, false
+	i := 0
+	switch w := word(0); w {
+	case "today", "tänään":
+		day, hasDay = today, true
+		i = 1
+	case "tomorrow", "huomenna":
+		day, hasDay = today.AddDate(0, 0, 1), true
+		i = 1
+	case "ylihuomenna":
+		day, hasDay = today.AddDate(0, 0, 2), true
+		i = 1
+	case "next", "ensi", "on":
+		if wd, ok := naturalWeekdays[word(1)]; ok {
+			strictWeekday = w != "on"
+			day, hasDay, weekday = nextWeekday(today, wd, strictWeekday), true, true
+			i = 2
+		}
+	default:
+		if wd, ok := naturalWeekdays[w]; ok {
+			day, hasDay, weekday = nextWeekday(today, wd, false), true, true
+			i = 1
+		}
+	}
+
+	hour, minute, hasTime := 9, 0, false
+	j := i
+	explicit := false
+	if w := word(j); w == "at" || w == "klo" || w == "kello" {
+		j++
+		explicit = true
+	}
+	if h, ok := naturalTimesOfDay[word(j)]; ok {
+		hour, minute, hasTime = h, 0, true
+	} else if h, m, ok := parseNaturalClock(word(j), explicit); ok {
+		hour, minute, hasTime = h, m, true
+	}
+	if hasTime {
+		i = j + 1
+	}
+
+	if !hasDay && !hasTime {
+		return time.Unix(0, 0), 0, errors.New("Not a natural language time")
+	}
+	if !hasDay {
+		day = today
+	}
+	reminderTime := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, loc)
+	if reminderTime.Unix() <= now.Unix() {
+		switch {
+		case !hasDay:
+			reminderTime = reminderTime.AddDate(0, 0, 1)
+		case weekday && !strictWeekday:
+			reminderTime = reminderTime.AddDate(0, 0, 7)
+		default:
+			return time.Unix(0, 0), 0, errors.New("Reminder date/time must be in future")
+		}
+	}
+	return reminderTime, i, nil
+}
+
+// nextWeekday returns the next day with the given weekday starting from today, or from tomorrow if strict is set
+func nextWeekday(today time.Time, wd time.Weekday, strict bool) time.Time {
+	days := (int(wd) - int(today.Weekday()) + 7) % 7
+	if strict && days == 0 {
+		days = 7
+	}
+	return today.AddDate(0, 0, days)
+}
+
+func addNaturalUnits(now time.Time, count, unit string) (time.Time, bool) {
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 1 {
+		return now, false
+	}
+	u, ok := naturalUnits[unit]
+	if !ok {
+		return now, false
+	}
+	return now.AddDate(u.years*n, u.months*n, u.days*n).Add(u.duration * time.Duration(n)), true
+}
+
+// parseNaturalClock parses a time of day such as "17:30", "17.30", "5pm" or "5:30am". Bare hours such as "17"
+// are only accepted if explicit is set, as they are otherwise indistinguishable from the reminder message
+func parseNaturalClock(s string, explicit bool) (int, int, bool) {
+	pm, am := strings.HasSuffix(s, "pm"), strings.HasSuffix(s, "am")
+	if pm || am {
+		s = s[:len(s)-2]
+	}
+	var hourStr, minuteStr string
+	if i := strings.IndexAny(s, ":."); i >= 0 {
+		hourStr, minuteStr = s[:i], s[i+1:]
+	} else if explicit || pm || am {
+		hourStr, minuteStr = s, "0"
+	} else {
+		return 0, 0, false
+	}
+	hour, err := strconv.Atoi(hourStr)
+	if err != nil {
+		return 0, 0, false
+	}
+	minute, err := strconv.Atoi(minuteStr)
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, 0, false
+	}
+	if pm || am {
+		if hour < 1 || hour > 12 {
+			return 0, 0, false
+		}
+		hour %= 12
+		if pm {
+			hour += 12
+		}
+	}
+	if hour < 0 || hour > 23 {
+		return 0, 0, false
+	}
+	return hour, minute, true
+}
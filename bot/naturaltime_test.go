@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRemindNaturalTime(t *testing.T) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 16, 14, 0, 0, 0, loc) // a friday
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, loc)
+	}
+
+	tests := []struct {
+		input string
+		want  time.Time
+		words int
+	}{
+		// weekdays
+		{"friday 17:30 meeting", at(10, 16, 17, 30), 2},
+		{"on friday 17:30 meeting", at(10, 16, 17, 30), 3},
+		{"next friday 17:30 meeting", at(10, 23, 17, 30), 3},
+		{"Monday meeting", at(10, 19, 9, 0), 1},
+		{"next monday meeting", at(10, 19, 9, 0), 2},
+		// same day times already past roll forward by a week
+		{"friday 9:00 meeting", at(10, 23, 9, 0), 2},
+		{"friday meeting", at(10, 23, 9, 0), 1},
+		// a bare hour without at is part of the message
+		{"friday 9 meeting", at(10, 23, 9, 0), 1},
+		// times of day without a day roll forward to tomorrow if already past
+		{"at 17 meeting", at(10, 16, 17, 0), 2},
+		{"13.00 meeting", at(10, 17, 13, 0), 1},
+		{"at 5pm meeting", at(10, 16, 17, 0), 2},
+		{"at 12am meeting", at(10, 17, 0, 0), 2},
+		{"at 12pm meeting", at(10, 17, 12, 0), 2},
+		{"tomorrow at 12am meeting", at(10, 17, 0, 0), 3},
+		{"tomorrow at 12pm meeting", at(10, 17, 12, 0), 3},
+		{"tomorrow at noon meeting", at(10, 17, 12, 0), 3},
+		// at followed by something other than a time is part of the message
+		{"tomorrow at home", at(10, 17, 9, 0), 1},
+		// relative times
+		{"in 2 weeks meeting", at(10, 30, 14, 0), 3},
+		{"in 1 month meeting", at(11, 16, 14, 0), 3},
+		{"in 90 minutes meeting", at(10, 16, 15, 30), 3},
+		// finnish
+		{"huomenna klo 8 kokous", at(10, 17, 8, 0), 3},
+		{"ylihuomenna kokous", at(10, 18, 9, 0), 1},
+		{"ensi perjantaina klo 17 kokous", at(10, 23, 17, 0), 4},
+		{"sunnuntaina kokous", at(10, 18, 9, 0), 1},
+		{"tänään kello 18.15 kokous", at(10, 16, 18, 15), 3},
+		{"keskipäivällä kokous", at(10, 17, 12, 0), 1},
+		{"2 viikon päästä kokous", at(10, 30, 14, 0), 3},
+	}
+	for _, test := range tests {
+		got, words, err := remindNaturalTime(now, strings.Split(test.input, " "))
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.input, err)
+			continue
+		}
+		if !got.Equal(test.want) || words != test.words {
+			t.Errorf("%q: got %v and %d words, want %v and %d words", test.input, got, words, test.want, test.words)
+		}
+	}
+}
+
+func TestRemindNaturalTimeErrors(t *testing.T) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 16, 14, 0, 0, 0, loc)
+
+	for _, input := range []string{
+		"buy milk",
+		"5 things",
+		"at home",
+		"in 2 bananas",
+		"in 0 days",
+		"at 13pm meeting",
+		"at 17:75 meeting",
+		"today 10:00 meeting", // already past
+		"tänään aamulla kokous",
+	} {
+		if got, words, err := remindNaturalTime(now, strings.Split(input, " ")); err == nil {
+			t.Errorf("%q: expected an error, got %v and %d words", input, got, words)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+)
+
+// roomSettingsLock guards the read-modify-write of the stored room settings
+var roomSettingsLock sync.Mutex
+
+// getRoomSettings returns the settings of every room keyed by room ID and setting name
+func getRoomSettings() map[string]map[string]json.RawMessage {
+	settingsJson := db.Get("room_settings")
+	var settings map[string]map[string]json.RawMessage
+	if settingsJson != "" {
+		json.Unmarshal([]byte(settingsJson), &settings)
+	}
+	if settings == nil {
+		settings = make(map[string]map[string]json.RawMessage)
+	}
+	return settings
+}
+
+func saveRoomSettings(settings map[string]map[string]json.RawMessage) {
+	res, err := json.Marshal(settings)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	db.Set("room_settings", string(res))
+}
+
+// getRoomSetting decodes a setting of the room into value and reports whether the setting was set
+func getRoomSetting(roomID, name string, value interface{}) bool {
+	raw, ok := getRoomSettings()[roomID][name]
+	if !ok {
+		return false
+	}
+	if err := json.Unmarshal(raw, value); err != nil {
+		log.Print(err)
+		return false
+	}
+	return true
+}
+
+func setRoomSetting(roomID, name string, value interface{}) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	roomSettingsLock.Lock()
+	defer roomSettingsLock.Unlock()
+	settings := getRoomSettings()
+	if settings[roomID] == nil {
+		settings[roomID] = make(map[string]json.RawMessage)
+	}
+	settings[roomID][name] = raw
+	saveRoomSettings(settings)
+}
+
+func deleteRoomSetting(roomID, name string) {
+	roomSettingsLock.Lock()
+	defer roomSettingsLock.Unlock()
+	settings := getRoomSettings()
+	delete(settings[roomID], name)
+	if len(settings[roomID]) == 0 {
+		delete(settings, roomID)
+	}
+	saveRoomSettings(settings)
+}
+
+// initRoomSettings moves the per-room settings that used to be stored under their own keys to the room settings
+func initRoomSettings() {
+	legacyKeys := map[string]string{
+		"quiet_hours":        "quiet_hours",
+		"streaming_settings": "streaming",
+		"room_locations":     "location",
+	}
+	roomSettingsLock.Lock()
+	defer roomSettingsLock.Unlock()
+	settings := getRoomSettings()
+	migrated := false
+	for key, name := range legacyKeys {
+		legacyJson := db.Get(key)
+		if legacyJson == "" {
+			continue
+		}
+		var legacy map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(legacyJson), &legacy); err != nil {
+			log.Print(err)
+			continue
+		}
+		for roomID, value := range legacy {
+			if settings[roomID] == nil {
+				settings[roomID] = make(map[string]json.RawMessage)
+			}
+			if _, ok := settings[roomID][name]; !ok {
+				settings[roomID][name] = value
+			}
+		}
+		migrated = true
+	}
+	if !migrated {
+		return
+	}
+	saveRoomSettings(settings)
+	for key := range legacyKeys {
+		db.Set(key, "")
+	}
+	log.Print("Migrated per-room settings to room_settings")
+}
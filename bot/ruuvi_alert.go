@@ -0,0 +1,287 @@
+package bot
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ruuviAlert struct {
+	ID         int64   `json:"id"`
+	RoomID     string  `json:"room_id"`
+	Endpoint   string  `json:"endpoint"`
+	Field      string  `json:"field"`
+	Above      bool    `json:"above"`
+	Threshold  float64 `json:"threshold"`
+	Hysteresis float64 `json:"hysteresis"`
+	Firing     bool    `json:"firing"`
+}
+
+const ruuviAlertInterval = time.Minute
+
+var ruuviAlertUnits = map[string]string{
+	"temperature": "ºC",
+	"humidity":    "%",
+}
+
+var ruuviAlertsLock sync.Mutex
+
+var ruuviAlertStatus struct {
+	sync.Mutex
+	lastChecked time.Time
+	lastError   string
+}
+
+func getRuuviAlerts() []ruuviAlert {
+	alertsJson := db.Get("ruuvi_alerts")
+	var alerts []ruuviAlert
+	if alertsJson != "" {
+		json.Unmarshal([]byte(alertsJson), &alerts)
+	}
+	return alerts
+}
+
+func saveRuuviAlerts(alerts []ruuviAlert) {
+	res, err := json.Marshal(alerts)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	db.Set("ruuvi_alerts", string(res))
+}
+
+// updateRuuviAlerts atomically replaces the stored alerts with the result of update
+func updateRuuviAlerts(update func([]ruuviAlert) []ruuviAlert) {
+	ruuviAlertsLock.Lock()
+	defer ruuviAlertsLock.Unlock()
+	saveRuuviAlerts(update(getRuuviAlerts()))
+}
+
+// nextRuuviAlertID must be called with ruuviAlertsLock held
+func nextRuuviAlertID() int64 {
+	id, _ := strconv.ParseInt(db.Get("ruuvi_alert_next_id"), 10, 64)
+	if id < 1 {
+		id = 1
+	}
+	db.Set("ruuvi_alert_next_id", strconv.FormatInt(id+1, 10))
+	return id
+}
+
+func (a ruuviAlert) condition() string {
+	direction := "below"
+	if a.Above {
+		direction = "above"
+	}
+	return a.Field + " " + direction + " " + strconv.FormatFloat(a.Threshold, 'f', -1, 64) + " " + ruuviAlertUnits[a.Field]
+}
+
+// exceeded returns whether the value crosses the threshold of the alert
+func (a ruuviAlert) exceeded(value float64) bool {
+	if a.Above {
+		return value > a.Threshold
+	}
+	return value < a.Threshold
+}
+
+// recovered returns whether the value is back within the threshold by at least the hysteresis
+func (a ruuviAlert) recovered(value float64) bool {
+	if a.Above {
+		return value <= a.Threshold-a.Hysteresis
+	}
+	return value >= a.Threshold+a.Hysteresis
+}
+
+func initRuuviAlerts() {
+	go func() {
+		for {
+			checkRuuviAlerts()
+			time.Sleep(ruuviAlertInterval)
+		}
+	}()
+	registerJob("ruuvi alert monitor", ruuviAlertMonitorStatus)
+}
+
+func ruuviAlertMonitorStatus() string {
+	ruuviAlertStatus.Lock()
+	defer ruuviAlertStatus.Unlock()
+	status := strconv.Itoa(len(getRuuviAlerts())) + " alerts, last checked at " + formatJobTime(ruuviAlertStatus.lastChecked)
+	if ruuviAlertStatus.lastError != "" {
+		status += ", last error: " + ruuviAlertStatus.lastError
+	}
+	return status
+}
+
+// checkRuuviAlerts queries the current values of every endpoint with alerts and notifies about the alerts that
+// started or stopped firing
+func checkRuuviAlerts() {
+	alerts := getRuuviAlerts()
+	if len(alerts) == 0 {
+		return
+	}
+	endpoints := make(map[string]ruuviEndpoint)
+	for _, e := range getRuuviEndpoints() {
+		endpoints[e.Name] = e
+	}
+	values := make(map[string][]float64)
+	var lastError string
+	for _, a := range alerts {
+		e, ok := endpoints[a.Endpoint]
+		if !ok {
+			continue
+		}
+		if _, ok := values[e.Name]; ok {
+			continue
+		}
+		resp, err := ruuviQueryGrafana(e.BaseURL, e.TagName, 0, "temperature", "humidity")
+		if err == nil {
+			values[e.Name], err = ruuviFloats(resp.LastRow(), 1, 2)
+		}
+		if err != nil {
+			lastError = e.Name + ": " + err.Error()
+			values[e.Name] = nil
+		}
+	}
+
+	changed := make(map[int64]bool)
+	for _, a := range alerts {
+		v := values[a.Endpoint]
+		if v == nil {
+			continue
+		}
+		value := v[0]
+		if a.Field == "humidity" {
+			value = v[1]
+		}
+		formattedValue := strconv.FormatFloat(value, 'f', 2, 64) + " " + ruuviAlertUnits[a.Field]
+		if !a.Firing && a.exceeded(value) {
+			changed[a.ID] = true
+			client.SendFormattedMessage(a.RoomID, "<font color=\"#FF0000\"><b>"+a.Endpoint+"</b>: "+a.condition()+"</font> (currently <b>"+formattedValue+"</b>)")
+		} else if a.Firing && a.recovered(value) {
+			changed[a.ID] = true
+			client.SendFormattedMessage(a.RoomID, "<font color=\"#00FF00\"><b>"+a.Endpoint+"</b>: back to normal</font> (currently <b>"+formattedValue+"</b>)")
+		}
+	}
+	if len(changed) > 0 {
+		updateRuuviAlerts(func(alerts []ruuviAlert) []ruuviAlert {
+			for i := range alerts {
+				if changed[alerts[i].ID] {
+					alerts[i].Firing = !alerts[i].Firing
+				}
+			}
+			return alerts
+		})
+	}
+
+	ruuviAlertStatus.Lock()
+	ruuviAlertStatus.lastChecked = time.Now()
+	ruuviAlertStatus.lastError = lastError
+	ruuviAlertStatus.Unlock()
+}
+
+func ruuviAlertCommand(roomID, sender string, params []string) {
+	if len(params) < 3 {
+		params = append(params, "list")
+	}
+	switch params[2] {
+	case "list":
+		var lines []string
+		for _, a := range getRuuviAlerts() {
+			if a.RoomID != roomID {
+				continue
+			}
+			line := "<li><b>#" + strconv.FormatInt(a.ID, 10) + "</b> " + a.Endpoint + ": " + a.condition() +
+				" (hysteresis " + strconv.FormatFloat(a.Hysteresis, 'f', -1, 64) + ")"
+			if a.Firing {
+				line += " <font color=\"#FF0000\">firing</font>"
+			}
+			lines = append(lines, line+"</li>")
+		}
+		if len(lines) == 0 {
+			client.SendMessage(roomID, "No ruuvi alerts in this room")
+			return
+		}
+		client.SendFormattedMessage(roomID, "Ruuvi alerts in this room:<ul>"+strings.Join(lines, "")+"</ul>")
+	case "add":
+		if !checkPermission(roomID, sender, "moderator") {
+			return
+		}
+		if len(params) < 8 {
+			client.SendMessage(roomID, "Usage: !ruuvi alert add <temperature|humidity> <above|below> <threshold> <hysteresis> <name>")
+			return
+		}
+		alert := ruuviAlert{RoomID: roomID, Field: params[3], Endpoint: strings.Join(params[7:], " ")}
+		if _, ok := ruuviAlertUnits[alert.Field]; !ok {
+			client.SendMessage(roomID, "Field must be temperature or humidity")
+			return
+		}
+		switch params[4] {
+		case "above":
+			alert.Above = true
+		case "below":
+			alert.Above = false
+		default:
+			client.SendMessage(roomID, "Direction must be above or below")
+			return
+		}
+		var err error
+		if alert.Threshold, err = strconv.ParseFloat(params[5], 64); err != nil {
+			client.SendMessage(roomID, "Invalid threshold: "+err.Error())
+			return
+		}
+		if alert.Hysteresis, err = strconv.ParseFloat(params[6], 64); err != nil || alert.Hysteresis < 0 {
+			client.SendMessage(roomID, "Hysteresis must be a non-negative number")
+			return
+		}
+		found := false
+		for _, e := range getRuuviEndpoints() {
+			if e.Name == alert.Endpoint {
+				found = true
+				break
+			}
+		}
+		if !found {
+			client.SendMessage(roomID, alert.Endpoint+" not found")
+			return
+		}
+		updateRuuviAlerts(func(alerts []ruuviAlert) []ruuviAlert {
+			alert.ID = nextRuuviAlertID()
+			return append(alerts, alert)
+		})
+		client.SendMessage(roomID, "Added alert #"+strconv.FormatInt(alert.ID, 10)+": "+alert.Endpoint+" "+alert.condition())
+	case "remove":
+		if !checkPermission(roomID, sender, "moderator") {
+			return
+		}
+		if len(params) < 4 {
+			client.SendMessage(roomID, "Usage: !ruuvi alert remove <id>")
+			return
+		}
+		id, err := strconv.ParseInt(strings.TrimPrefix(params[3], "#"), 10, 64)
+		if err != nil {
+			client.SendMessage(roomID, "Invalid alert ID: "+params[3])
+			return
+		}
+		removed := false
+		updateRuuviAlerts(func(alerts []ruuviAlert) []ruuviAlert {
+			var newAlerts []ruuviAlert
+			for _, a := range alerts {
+				if a.ID == id && a.RoomID == roomID {
+					removed = true
+					continue
+				}
+				newAlerts = append(newAlerts, a)
+			}
+			return newAlerts
+		})
+		if !removed {
+			client.SendMessage(roomID, "No alert #"+strconv.FormatInt(id, 10)+" in this room")
+			return
+		}
+		client.SendMessage(roomID, "Removed alert #"+strconv.FormatInt(id, 10))
+	default:
+		client.SendMessage(roomID, "Usage: !ruuvi alert <list|add|remove>")
+	}
+}
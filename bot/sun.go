@@ -0,0 +1,72 @@
+package bot
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type location struct {
+	Latitude  float64 `json:"lat"`
+	Longitude float64 `json:"lon"`
+}
+
+// defaultLocation is used for rooms without a configured location (Helsinki, to match the default timezone)
+var defaultLocation = location{60.1699, 24.9384}
+
+func getRoomLocation(roomID string) location {
+	var loc location
+	if getRoomSetting(roomID, "location", &loc) {
+		return loc
+	}
+	return defaultLocation
+}
+
+// parseLocation parses coordinates given as latitude and longitude separated by a space or a comma
+func parseLocation(s string) (location, error) {
+	coords := strings.Fields(strings.Replace(s, ",", " ", -1))
+	if len(coords) != 2 {
+		return location{}, errors.New("Location must be given as <latitude> <longitude>")
+	}
+	lat, latErr := strconv.ParseFloat(coords[0], 64)
+	lon, lonErr := strconv.ParseFloat(coords[1], 64)
+	if latErr != nil || lonErr != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return location{}, errors.New("Invalid coordinates: " + s)
+	}
+	return location{lat, lon}, nil
+}
+
+func (l location) String() string {
+	return strconv.FormatFloat(l.Latitude, 'f', 4, 64) + " " + strconv.FormatFloat(l.Longitude, 'f', 4, 64)
+}
+
+func toJulian(t time.Time) float64 {
+	return float64(t.Unix())/86400 + 2440587.5
+}
+
+func fromJulian(j float64) time.Time {
+	return time.Unix(int64(math.Round((j-2440587.5)*86400)), 0)
+}
+
+// sunTimes calculates the sunrise and sunset on the given date at the given location using the sunrise equation.
+// ok is false if the sun doesn't rise or set on that day (polar day or polar night)
+func sunTimes(date time.Time, loc location) (sunrise, sunset time.Time, ok bool) {
+	const rad = math.Pi / 180
+	noon := time.Date(date.Year(), date.Month(), date.Day(), 12, 0, 0, 0, date.Location())
+	n := math.Round(toJulian(noon) - 2451545.0 + loc.Longitude/360)
+	meanSolarTime := n - loc.Longitude/360
+	anomaly := math.Mod(357.5291+0.98560028*meanSolarTime, 360)
+	center := 1.9148*math.Sin(anomaly*rad) + 0.02*math.Sin(2*anomaly*rad) + 0.0003*math.Sin(3*anomaly*rad)
+	eclipticLongitude := math.Mod(anomaly+center+180+102.9372, 360)
+	transit := 2451545.0 + meanSolarTime + 0.0053*math.Sin(anomaly*rad) - 0.0069*math.Sin(2*eclipticLongitude*rad)
+	declination := math.Asin(math.Sin(eclipticLongitude*rad) * math.Sin(23.4397*rad))
+	cosHourAngle := (math.Sin(-0.833*rad) - math.Sin(loc.Latitude*rad)*math.Sin(declination)) /
+		(math.Cos(loc.Latitude*rad) * math.Cos(declination))
+	if cosHourAngle > 1 || cosHourAngle < -1 {
+		return time.Time{}, time.Time{}, false
+	}
+	hourAngle := math.Acos(cosHourAngle) / rad
+	return fromJulian(transit - hourAngle/360), fromJulian(transit + hourAngle/360), true
+}
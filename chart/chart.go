@@ -0,0 +1,159 @@
+package chart
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"strconv"
+)
+
+// Point is a single data point of a line chart
+type Point struct {
+	X float64
+	Y float64
+}
+
+const (
+	margin       = 10
+	labelPadding = 6
+	gridLines    = 5
+	lineWeight   = 2
+)
+
+var (
+	backgroundColor = color.RGBA{0x18, 0x1b, 0x1f, 0xff}
+	gridColor       = color.RGBA{0x3a, 0x3e, 0x45, 0xff}
+	labelColor      = color.RGBA{0xc7, 0xd0, 0xd9, 0xff}
+	lineColor       = color.RGBA{0x73, 0xbf, 0x69, 0xff}
+)
+
+// RenderLine renders the points as a line chart and returns it encoded as a PNG. The axes are scaled to the range of
+// the points, and grid lines divide both ranges to equal parts. The grid lines are labeled with their values formatted
+// with formatX and formatY, or as plain numbers if they are nil
+func RenderLine(points []Point, width, height int, formatX, formatY func(float64) string) ([]byte, error) {
+	if len(points) < 2 {
+		return nil, errors.New("At least two points are needed for a chart")
+	}
+	if formatX == nil {
+		formatX = formatNumber
+	}
+	if formatY == nil {
+		formatY = formatNumber
+	}
+	minX, maxX := points[0].X, points[0].X
+	minY, maxY := points[0].Y, points[0].Y
+	for _, p := range points {
+		minX, maxX = math.Min(minX, p.X), math.Max(maxX, p.X)
+		minY, maxY = math.Min(minY, p.Y), math.Max(maxY, p.Y)
+	}
+	if maxX == minX {
+		maxX = minX + 1
+	}
+	if maxY == minY {
+		minY, maxY = minY-1, maxY+1
+	}
+
+	var xLabels, yLabels [gridLines + 1]string
+	yLabelWidth := 0
+	for i := 0; i <= gridLines; i++ {
+		xLabels[i] = formatX(minX + (maxX-minX)*float64(i)/gridLines)
+		yLabels[i] = formatY(maxY - (maxY-minY)*float64(i)/gridLines)
+		if w := textWidth(yLabels[i]); w > yLabelWidth {
+			yLabelWidth = w
+		}
+	}
+	left, top := yLabelWidth+2*labelPadding, margin
+	plotWidth, plotHeight := width-left-margin, height-top-textHeight-2*labelPadding
+	if plotWidth < 1 || plotHeight < 1 {
+		return nil, errors.New("Chart is too small for its labels")
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, backgroundColor)
+		}
+	}
+	for i := 0; i <= gridLines; i++ {
+		y := top + plotHeight*i/gridLines
+		for x := left; x <= left+plotWidth; x++ {
+			img.Set(x, y, gridColor)
+		}
+		drawText(img, left-labelPadding-textWidth(yLabels[i]), y-textHeight/2, yLabels[i], labelColor)
+
+		x := left + plotWidth*i/gridLines
+		for y := top; y <= top+plotHeight; y++ {
+			img.Set(x, y, gridColor)
+		}
+		labelX := x - textWidth(xLabels[i])/2
+		if labelX+textWidth(xLabels[i]) > width {
+			labelX = width - textWidth(xLabels[i])
+		}
+		if labelX < 0 {
+			labelX = 0
+		}
+		drawText(img, labelX, top+plotHeight+labelPadding, xLabels[i], labelColor)
+	}
+
+	toPixel := func(p Point) (int, int) {
+		x := left + int(math.Round((p.X-minX)/(maxX-minX)*float64(plotWidth)))
+		y := top + plotHeight - int(math.Round((p.Y-minY)/(maxY-minY)*float64(plotHeight)))
+		return x, y
+	}
+	prevX, prevY := toPixel(points[0])
+	for _, p := range points[1:] {
+		x, y := toPixel(p)
+		drawLine(img, prevX, prevY, x, y, lineColor)
+		prevX, prevY = x, y
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func formatNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+// drawLine draws a line between two points using Bresenham's line algorithm
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		for i := 0; i < lineWeight; i++ {
+			img.Set(x0, y0+i, c)
+		}
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
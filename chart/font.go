@@ -0,0 +1,66 @@
+package chart
+
+import (
+	"image"
+	"image/color"
+)
+
+// A tiny built-in bitmap font for the axis labels. Each glyph is 3 pixels wide and 5 pixels tall, and is drawn scaled
+// up by fontScale. Only the characters needed for numbers, dates and times are included, others are drawn as spaces
+const (
+	glyphWidth   = 3
+	glyphHeight  = 5
+	glyphSpacing = 1
+	fontScale    = 2
+)
+
+var glyphs = map[rune][glyphHeight]string{
+	'0': {"###", "#.#", "#.#", "#.#", "###"},
+	'1': {".#.", "##.", ".#.", ".#.", "###"},
+	'2': {"###", "..#", "###", "#..", "###"},
+	'3': {"###", "..#", ".##", "..#", "###"},
+	'4': {"#.#", "#.#", "###", "..#", "..#"},
+	'5': {"###", "#..", "###", "..#", "###"},
+	'6': {"###", "#..", "###", "#.#", "###"},
+	'7': {"###", "..#", "..#", ".#.", ".#."},
+	'8': {"###", "#.#", "###", "#.#", "###"},
+	'9': {"###", "#.#", "###", "..#", "###"},
+	'-': {"...", "...", "###", "...", "..."},
+	'.': {"...", "...", "...", "...", ".#."},
+	':': {"...", ".#.", "...", ".#.", "..."},
+	'/': {"..#", "..#", ".#.", "#..", "#.."},
+	'%': {"#.#", "..#", ".#.", "#..", "#.#"},
+}
+
+// textWidth returns the width of the text in pixels when drawn with drawText
+func textWidth(s string) int {
+	n := len([]rune(s))
+	if n == 0 {
+		return 0
+	}
+	return (n*(glyphWidth+glyphSpacing) - glyphSpacing) * fontScale
+}
+
+// textHeight is the height of the text in pixels when drawn with drawText
+const textHeight = glyphHeight * fontScale
+
+// drawText draws the text with its top left corner at x, y
+func drawText(img *image.RGBA, x, y int, s string, c color.Color) {
+	for _, r := range s {
+		if glyph, ok := glyphs[r]; ok {
+			for row, line := range glyph {
+				for col, pixel := range line {
+					if pixel != '#' {
+						continue
+					}
+					for dx := 0; dx < fontScale; dx++ {
+						for dy := 0; dy < fontScale; dy++ {
+							img.Set(x+col*fontScale+dx, y+row*fontScale+dy, c)
+						}
+					}
+				}
+			}
+		}
+		x += (glyphWidth + glyphSpacing) * fontScale
+	}
+}
@@ -0,0 +1,201 @@
+package grafana
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Response is an InfluxDB query response as returned through the Grafana datasource proxy
+type Response struct {
+	Results []struct {
+		Series []Series `json:"series"`
+		Error  string   `json:"error"`
+	} `json:"results"`
+}
+
+// Series is a single series of an InfluxDB query response. The first value of every row is the timestamp
+type Series struct {
+	Name    string            `json:"name"`
+	Tags    map[string]string `json:"tags"`
+	Columns []string          `json:"columns"`
+	Values  [][]interface{}   `json:"values"`
+}
+
+// ErrNoData is returned when a query succeeds but has no data points
+var ErrNoData = errors.New("No data")
+
+// Query performs a query against a Grafana datasource proxy URL.
+//
+// The returned response is guaranteed to have at least one series with at least one row
+func Query(queryURL string) (*Response, error) {
+	resp, err := http.Get(queryURL)
+	if err != nil {
+		if err.Error() != "EOF" {
+			return nil, err
+		}
+		resp, err = http.Get(queryURL) // the proxy occasionally drops idle connections, retry once
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var grafanaResp Response
+	if err = json.NewDecoder(resp.Body).Decode(&grafanaResp); err != nil {
+		return nil, err
+	}
+	if len(grafanaResp.Results) < 1 {
+		return nil, ErrNoData
+	}
+	if grafanaResp.Results[0].Error != "" {
+		return nil, errors.New(grafanaResp.Results[0].Error)
+	}
+	if len(grafanaResp.Results[0].Series) < 1 || len(grafanaResp.Results[0].Series[0].Values) < 1 {
+		return nil, ErrNoData
+	}
+	return &grafanaResp, nil
+}
+
+// LastQueryURL builds a query URL selecting the last values of the given fields within an hour before now-offset,
+// from the series of an InfluxDB measurement where tagKey equals tagValue
+func LastQueryURL(baseURL, measurement, tagKey, tagValue string, offset time.Duration, fields ...string) string {
+	var queryBuilder strings.Builder
+	queryBuilder.WriteString(baseURL)
+	queryBuilder.WriteString(`&q=SELECT%20`)
+	for i, f := range fields {
+		if i > 0 {
+			queryBuilder.WriteString(",")
+		}
+		queryBuilder.WriteString(`last("`)
+		queryBuilder.WriteString(strings.Replace(f, `"`, "", -1))
+		queryBuilder.WriteString(`")`)
+	}
+	queryBuilder.WriteString(`%20FROM%20"`)
+	queryBuilder.WriteString(strings.Replace(measurement, `"`, "", -1))
+	queryBuilder.WriteString(`"%20WHERE%20("`)
+	queryBuilder.WriteString(strings.Replace(tagKey, `"`, "", -1))
+	queryBuilder.WriteString(`"%20%3D%20%27`)
+	queryBuilder.WriteString(strings.Replace(tagValue, `"`, "", -1))
+	queryBuilder.WriteString(`%27)%20AND%20time%20<%3D%20now()%20-%20`)
+	queryBuilder.WriteString(strconv.FormatInt(int64(offset/time.Second), 10))
+	queryBuilder.WriteString(`s%20AND%20time%20>%3D%20now()%20-%20`)
+	queryBuilder.WriteString(strconv.FormatInt(int64((offset+time.Hour)/time.Second), 10))
+	queryBuilder.WriteString(`s`)
+	return queryBuilder.String()
+}
+
+// HistoryQueryURL builds a query URL selecting the mean of a field over the given duration before now grouped to
+// intervals, from the series of an InfluxDB measurement where tagKey equals tagValue
+func HistoryQueryURL(baseURL, measurement, tagKey, tagValue, field string, duration, interval time.Duration) string {
+	var queryBuilder strings.Builder
+	queryBuilder.WriteString(baseURL)
+	queryBuilder.WriteString(`&epoch=ms&q=SELECT%20mean("`)
+	queryBuilder.WriteString(strings.Replace(field, `"`, "", -1))
+	queryBuilder.WriteString(`")%20FROM%20"`)
+	queryBuilder.WriteString(strings.Replace(measurement, `"`, "", -1))
+	queryBuilder.WriteString(`"%20WHERE%20("`)
+	queryBuilder.WriteString(strings.Replace(tagKey, `"`, "", -1))
+	queryBuilder.WriteString(`"%20%3D%20%27`)
+	queryBuilder.WriteString(strings.Replace(tagValue, `"`, "", -1))
+	queryBuilder.WriteString(`%27)%20AND%20time%20>%3D%20now()%20-%20`)
+	queryBuilder.WriteString(strconv.FormatInt(int64(duration/time.Second), 10))
+	queryBuilder.WriteString(`s%20GROUP%20BY%20time(`)
+	queryBuilder.WriteString(strconv.FormatInt(int64(interval/time.Second), 10))
+	queryBuilder.WriteString(`s)%20fill(none)`)
+	return queryBuilder.String()
+}
+
+// LastRow returns the latest row of the first series of the response
+func (r *Response) LastRow() []interface{} {
+	values := r.Results[0].Series[0].Values
+	return values[len(values)-1]
+}
+
+// FormattedValue returns the latest value of the response formatted for display. If the response contains multiple
+// series, the value of each is listed with the series' tags
+func (r *Response) FormattedValue() string {
+	return r.formattedValue(func(values [][]interface{}) []interface{} { return values[len(values)-1] })
+}
+
+// FormattedFirstValue is like FormattedValue, but returns the first value of each series instead of the latest
+func (r *Response) FormattedFirstValue() string {
+	return r.formattedValue(func(values [][]interface{}) []interface{} { return values[0] })
+}
+
+func (r *Response) formattedValue(row func([][]interface{}) []interface{}) string {
+	series := r.Results[0].Series
+	if len(series) == 1 {
+		return FormatValue(valueAt(row(series[0].Values), 1))
+	}
+	var parts []string
+	for _, s := range series {
+		if len(s.Values) == 0 {
+			continue
+		}
+		var tags []string
+		for _, v := range s.Tags {
+			tags = append(tags, v)
+		}
+		sort.Strings(tags)
+		name := strings.Join(tags, " ")
+		if name == "" {
+			name = s.Name
+		}
+		parts = append(parts, name+": "+FormatValue(valueAt(row(s.Values), 1)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func valueAt(row []interface{}, i int) interface{} {
+	if i >= len(row) {
+		return nil
+	}
+	return row[i]
+}
+
+// Float returns a value of a response row as a float
+func Float(v interface{}) (float64, error) {
+	switch value := v.(type) {
+	case float64:
+		return value, nil
+	case string:
+		return strconv.ParseFloat(value, 64)
+	case nil:
+		return 0, ErrNoData
+	default:
+		return 0, errors.New("Unexpected value type")
+	}
+}
+
+// Time returns the timestamp of a response row as a time, accepting both epoch milliseconds and RFC3339 timestamps
+func Time(v interface{}) (time.Time, error) {
+	switch value := v.(type) {
+	case float64:
+		return time.Unix(0, int64(value)*int64(time.Millisecond)), nil
+	case string:
+		return time.Parse(time.RFC3339Nano, value)
+	default:
+		return time.Time{}, errors.New("Unexpected timestamp type")
+	}
+}
+
+// FormatValue formats a value of a response row for display
+func FormatValue(v interface{}) string {
+	switch value := v.(type) {
+	case float64:
+		return strconv.FormatFloat(value, 'f', 2, 64)
+	case string:
+		return value
+	case bool:
+		return strconv.FormatBool(value)
+	case nil:
+		return "N/A"
+	default:
+		res, _ := json.Marshal(value)
+		return string(res)
+	}
+}
@@ -0,0 +1,142 @@
+package grafana
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T, body string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestQuery(t *testing.T) {
+	server := newTestServer(t, `{"results":[{"series":[{"name":"ruuvi_measurements","columns":["time","last"],"values":[[1000,20.5],[2000,21.25]]}]}]}`)
+	resp, err := Query(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.FormattedValue(); got != "21.25" {
+		t.Errorf("FormattedValue() = %q, want %q", got, "21.25")
+	}
+	if got := resp.FormattedFirstValue(); got != "20.50" {
+		t.Errorf("FormattedFirstValue() = %q, want %q", got, "20.50")
+	}
+	if row := resp.LastRow(); row[0] != float64(2000) {
+		t.Errorf("LastRow() = %v, want the row at 2000", row)
+	}
+}
+
+func TestQueryError(t *testing.T) {
+	server := newTestServer(t, `{"results":[{"error":"database not found: foo"}]}`)
+	if _, err := Query(server.URL); err == nil || err.Error() != "database not found: foo" {
+		t.Errorf("Query() error = %v, want the error of the result", err)
+	}
+}
+
+func TestQueryNoData(t *testing.T) {
+	for _, body := range []string{
+		`{"results":[]}`,
+		`{"results":[{}]}`,
+		`{"results":[{"series":[]}]}`,
+		`{"results":[{"series":[{"name":"m","columns":["time","last"],"values":[]}]}]}`,
+	} {
+		server := newTestServer(t, body)
+		if _, err := Query(server.URL); err != ErrNoData {
+			t.Errorf("Query() of %s error = %v, want ErrNoData", body, err)
+		}
+	}
+}
+
+func TestFormattedFirstValue(t *testing.T) {
+	server := newTestServer(t, `{"results":[{"series":[`+
+		`{"name":"m","tags":{"name":"sauna"},"columns":["time","last"],"values":[[1000,80],[2000,85]]},`+
+		`{"name":"m","tags":{"name":"balcony"},"columns":["time","last"],"values":[[1000,"-3.5"],[2000,"-4"]]}]}]}`)
+	resp, err := Query(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := resp.FormattedFirstValue(), "sauna: 80.00, balcony: -3.5"; got != want {
+		t.Errorf("FormattedFirstValue() = %q, want %q", got, want)
+	}
+	if got, want := resp.FormattedValue(), "sauna: 85.00, balcony: -4"; got != want {
+		t.Errorf("FormattedValue() = %q, want %q", got, want)
+	}
+}
+
+func TestFormattedValueMultipleSeries(t *testing.T) {
+	server := newTestServer(t, `{"results":[{"series":[`+
+		`{"name":"m","tags":{"name":"sauna"},"columns":["time","last"],"values":[[1000,80]]},`+
+		`{"name":"m","tags":{"name":"balcony"},"columns":["time","last"],"values":[[1000,"-3.5"]]},`+
+		`{"name":"m","tags":{"name":"empty"},"columns":["time","last"],"values":[]},`+
+		`{"name":"untagged","columns":["time","last"],"values":[[1000,null]]}]}]}`)
+	resp, err := Query(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "sauna: 80.00, balcony: -3.5, untagged: N/A"
+	if got := resp.FormattedValue(); got != want {
+		t.Errorf("FormattedValue() = %q, want %q", got, want)
+	}
+}
+
+func TestFloat(t *testing.T) {
+	tests := []struct {
+		value   interface{}
+		want    float64
+		wantErr bool
+	}{
+		{21.5, 21.5, false},
+		{"21.5", 21.5, false},
+		{"warm", 0, true},
+		{nil, 0, true},
+		{true, 0, true},
+	}
+	for _, test := range tests {
+		got, err := Float(test.value)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("Float(%v) = %v, %v, want %v, error %v", test.value, got, err, test.want, test.wantErr)
+		}
+	}
+	if _, err := Float(nil); err != ErrNoData {
+		t.Errorf("Float(nil) error = %v, want ErrNoData", err)
+	}
+}
+
+func TestTime(t *testing.T) {
+	want := time.Date(2026, 10, 16, 12, 30, 0, 0, time.UTC)
+	tests := []interface{}{float64(want.UnixNano() / int64(time.Millisecond)), "2026-10-16T12:30:00Z"}
+	for _, value := range tests {
+		got, err := Time(value)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("Time(%v) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+	if _, err := Time(true); err == nil {
+		t.Error("Time(true) expected an error")
+	}
+}
+
+func TestLastQueryURL(t *testing.T) {
+	got := LastQueryURL("http://grafana/api/datasources/proxy/1/query?db=ruuvi", "ruuvi_measurements", "name", "sauna", time.Hour, "temperature", "humidity")
+	want := `http://grafana/api/datasources/proxy/1/query?db=ruuvi&q=SELECT%20last("temperature"),last("humidity")%20FROM%20"ruuvi_measurements"` +
+		`%20WHERE%20("name"%20%3D%20%27sauna%27)%20AND%20time%20<%3D%20now()%20-%203600s%20AND%20time%20>%3D%20now()%20-%207200s`
+	if got != want {
+		t.Errorf("LastQueryURL() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHistoryQueryURL(t *testing.T) {
+	got := HistoryQueryURL("http://grafana/api/datasources/proxy/1/query?db=ruuvi", "ruuvi_measurements", "name", "sauna", "temperature", 24*time.Hour, 5*time.Minute)
+	want := `http://grafana/api/datasources/proxy/1/query?db=ruuvi&epoch=ms&q=SELECT%20mean("temperature")%20FROM%20"ruuvi_measurements"` +
+		`%20WHERE%20("name"%20%3D%20%27sauna%27)%20AND%20time%20>%3D%20now()%20-%2086400s%20GROUP%20BY%20time(300s)%20fill(none)`
+	if got != want {
+		t.Errorf("HistoryQueryURL() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,62 @@
+package grafana
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// RenderURL converts a dashboard panel URL, such as one copied from the share or view panel links, to a URL of the
+// Grafana image renderer for that panel. Query parameters such as the time range and variables are kept
+func RenderURL(panelURL string, width, height int) (string, error) {
+	u, err := url.Parse(panelURL)
+	if err != nil {
+		return "", err
+	}
+	path := strings.TrimPrefix(u.Path, "/")
+	switch {
+	case strings.HasPrefix(path, "d/"):
+		u.Path = "/render/d-solo/" + strings.TrimPrefix(path, "d/")
+	case strings.HasPrefix(path, "d-solo/"):
+		u.Path = "/render/" + path
+	case strings.HasPrefix(path, "render/d-solo/"):
+	default:
+		return "", errors.New("Not a Grafana dashboard panel URL")
+	}
+	query := u.Query()
+	if query.Get("panelId") == "" {
+		query.Set("panelId", query.Get("viewPanel"))
+	}
+	query.Del("viewPanel")
+	if query.Get("panelId") == "" {
+		return "", errors.New("The URL does not select a panel")
+	}
+	query.Set("width", strconv.Itoa(width))
+	query.Set("height", strconv.Itoa(height))
+	u.RawQuery = query.Encode()
+	u.Fragment = ""
+	return u.String(), nil
+}
+
+// Render fetches a PNG image of a panel from a render URL
+func Render(renderURL string) ([]byte, error) {
+	resp, err := http.Get(renderURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("Rendering failed: " + resp.Status)
+	}
+	if contentType := http.DetectContentType(data); contentType != "image/png" {
+		return nil, errors.New("Rendering failed: unexpected response of type " + contentType)
+	}
+	return data, nil
+}
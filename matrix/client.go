@@ -79,6 +79,11 @@ func (c Client) OnEvent(eventType string, callback gomatrix.OnEventListener) {
 	c.client.Syncer.(*gomatrix.DefaultSyncer).OnEventType(eventType, callback)
 }
 
+// OutboundQueueLength returns the number of events waiting in the outbound queue and the capacity of the queue
+func (c Client) OutboundQueueLength() (length, capacity int) {
+	return len(c.outboundEvents), cap(c.outboundEvents)
+}
+
 func (c Client) JoinRoom(roomID string) {
 	_, err := c.client.JoinRoom(roomID, "", nil)
 	if err != nil {
@@ -86,6 +91,36 @@ func (c Client) JoinRoom(roomID string) {
 	}
 }
 
+// IsDirectRoom returns whether the only joined members of the room are the bot and the given user
+func (c Client) IsDirectRoom(roomID, userID string) bool {
+	resp, err := c.client.JoinedMembers(roomID)
+	if err != nil {
+		log.Print("Failed to get members of room "+roomID+": ", err)
+		return false
+	}
+	if len(resp.Joined) != 2 {
+		return false
+	}
+	_, ok := resp.Joined[userID]
+	return ok
+}
+
+// PowerLevel returns the power level of the user in the room, or 0 if it cannot be determined
+func (c Client) PowerLevel(roomID, userID string) int {
+	var powerLevels struct {
+		Users        map[string]int `json:"users"`
+		UsersDefault int            `json:"users_default"`
+	}
+	if err := c.client.StateEvent(roomID, "m.room.power_levels", "", &powerLevels); err != nil {
+		log.Print("Failed to get power levels of room "+roomID+": ", err)
+		return 0
+	}
+	if level, ok := powerLevels.Users[userID]; ok {
+		return level
+	}
+	return powerLevels.UsersDefault
+}
+
 func (c Client) GetDisplayName(mxid string) string {
 	foo, err := c.client.GetDisplayName(mxid)
 	if err != nil {
@@ -122,6 +157,24 @@ func (c Client) SendFormattedNotice(roomID string, notice string) <-chan string
 	return c.sendMessage(roomID, simpleMessage{"m.notice", stripFormatting(notice), "org.matrix.custom.html", notice}, true)
 }
 
+// EditFormattedNotice queues an edit that replaces the content of an earlier notice with a html-formatted notice and returns immediatedly.
+//
+// The returned channel will provide the event ID of the edit after the edit has been sent
+func (c Client) EditFormattedNotice(roomID, eventID string, notice string) <-chan string {
+	msgEdit := messageEdit{}
+	msgEdit.MsgType = "m.notice"
+	msgEdit.Body = stripFormatting(notice)
+	msgEdit.Format = "org.matrix.custom.html"
+	msgEdit.FormattedBody = notice
+	msgEdit.NewContent.MsgType = "m.notice"
+	msgEdit.NewContent.Body = stripFormatting(notice)
+	msgEdit.NewContent.Format = "org.matrix.custom.html"
+	msgEdit.NewContent.FormattedBody = notice
+	msgEdit.RelatesTo.RelType = "m.replace"
+	msgEdit.RelatesTo.EventID = eventID
+	return c.sendMessage(roomID, msgEdit, true)
+}
+
 func stripFormatting(s string) string {
 	// paragraph and header tags are on their own lines
 	s = strings.Replace(s, "<p>", "\n", -1)
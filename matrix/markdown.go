@@ -0,0 +1,115 @@
+package matrix
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	markdownHeading = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	markdownBold    = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	markdownItalic  = regexp.MustCompile(`(^|[^\w*])[*_]([^*_]+?)[*_]($|[^\w*])`)
+	markdownLink    = regexp.MustCompile(`\[([^\]]+)\]\((https?://[^)\s]+)\)`)
+)
+
+// SendMarkdownMessage queues a markdown-formatted message to be sent and returns immediatedly.
+//
+// Only a small subset of markdown is supported: headings, lists, fenced code blocks, inline code, bold, italics and links.
+// The returned channel will provide the event ID of the message after the message has been sent
+func (c Client) SendMarkdownMessage(roomID string, message string) <-chan string {
+	return c.sendMessage(roomID, simpleMessage{"m.text", message, "org.matrix.custom.html", renderMarkdown(message)}, true)
+}
+
+// SendMarkdownNotice queues a markdown-formatted notice to be sent and returns immediatedly.
+//
+// Only a small subset of markdown is supported: headings, lists, fenced code blocks, inline code, bold, italics and links.
+// The returned channel will provide the event ID of the notice after the notice has been sent
+func (c Client) SendMarkdownNotice(roomID string, notice string) <-chan string {
+	return c.sendMessage(roomID, simpleMessage{"m.notice", notice, "org.matrix.custom.html", renderMarkdown(notice)}, true)
+}
+
+func renderMarkdown(s string) string {
+	var out []string
+	var paragraph []string
+	var list []string
+	var code []string
+	inCode := false
+
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			out = append(out, "<p>"+strings.Join(paragraph, "<br>")+"</p>")
+			paragraph = nil
+		}
+	}
+	flushList := func() {
+		if len(list) > 0 {
+			out = append(out, "<ul><li>"+strings.Join(list, "</li><li>")+"</li></ul>")
+			list = nil
+		}
+	}
+
+	for _, line := range strings.Split(strings.Replace(s, "\r\n", "\n", -1), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			if inCode {
+				out = append(out, "<pre><code>"+html.EscapeString(strings.Join(code, "\n"))+"</code></pre>")
+				code = nil
+			} else {
+				flushParagraph()
+				flushList()
+			}
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			code = append(code, line)
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flushParagraph()
+			flushList()
+		case markdownHeading.MatchString(trimmed):
+			flushParagraph()
+			flushList()
+			m := markdownHeading.FindStringSubmatch(trimmed)
+			tag := "h" + strconv.Itoa(len(m[1]))
+			out = append(out, "<"+tag+">"+renderInlineMarkdown(m[2])+"</"+tag+">")
+		case strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* "):
+			flushParagraph()
+			list = append(list, renderInlineMarkdown(trimmed[2:]))
+		default:
+			flushList()
+			paragraph = append(paragraph, renderInlineMarkdown(line))
+		}
+	}
+	if inCode { // unterminated code block, render what we have
+		out = append(out, "<pre><code>"+html.EscapeString(strings.Join(code, "\n"))+"</code></pre>")
+	}
+	flushParagraph()
+	flushList()
+	return strings.Join(out, "")
+}
+
+func renderInlineMarkdown(s string) string {
+	// every odd part is inside a code span and is left as-is apart from escaping
+	parts := strings.Split(s, "`")
+	if len(parts)%2 == 0 { // unbalanced backtick, treat the last one literally
+		parts[len(parts)-2] += "`" + parts[len(parts)-1]
+		parts = parts[:len(parts)-1]
+	}
+	for i, part := range parts {
+		part = html.EscapeString(part)
+		if i%2 == 1 {
+			parts[i] = "<code>" + part + "</code>"
+			continue
+		}
+		part = markdownLink.ReplaceAllString(part, `<a href="$2">$1</a>`)
+		part = markdownBold.ReplaceAllString(part, "<b>$1</b>")
+		part = markdownItalic.ReplaceAllString(part, "$1<i>$2</i>$3")
+		parts[i] = part
+	}
+	return strings.Join(parts, "")
+}
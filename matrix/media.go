@@ -0,0 +1,50 @@
+package matrix
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+)
+
+type imageMessage struct {
+	MsgType string    `json:"msgtype"`
+	Body    string    `json:"body"`
+	URL     string    `json:"url"`
+	Info    imageInfo `json:"info"`
+}
+
+type imageInfo struct {
+	Mimetype string `json:"mimetype"`
+	Size     int    `json:"size"`
+	Width    int    `json:"w,omitempty"`
+	Height   int    `json:"h,omitempty"`
+}
+
+// UploadMedia uploads the given data to the media repository of the homeserver and returns the mxc:// URI of the upload
+func (c Client) UploadMedia(data []byte, contentType string) (string, error) {
+	resp, err := c.client.UploadToContentRepo(bytes.NewReader(data), contentType, int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	return resp.ContentURI, nil
+}
+
+// SendImage uploads an image and queues an image message of it to be sent. The upload is done before returning.
+//
+// The body is used as the description of the image. The returned channel will provide the event ID of the message after the message has been sent
+func (c Client) SendImage(roomID, body string, data []byte) (<-chan string, error) {
+	contentType := http.DetectContentType(data)
+	uri, err := c.UploadMedia(data, contentType)
+	if err != nil {
+		return nil, err
+	}
+	info := imageInfo{Mimetype: contentType, Size: len(data)}
+	if config, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		info.Width = config.Width
+		info.Height = config.Height
+	}
+	return c.sendMessage(roomID, imageMessage{"m.image", body, uri, info}, true), nil
+}
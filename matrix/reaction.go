@@ -0,0 +1,40 @@
+package matrix
+
+import (
+	"github.com/matrix-org/gomatrix"
+)
+
+type reaction struct {
+	RelatesTo struct {
+		RelType string `json:"rel_type"`
+		EventID string `json:"event_id"`
+		Key     string `json:"key"`
+	} `json:"m.relates_to"`
+}
+
+// SendReaction queues a reaction with the given key, usually an emoji, to an event to be sent.
+//
+// The returned channel will provide the event ID of the reaction after it has been sent
+func (c Client) SendReaction(roomID, eventID, key string) <-chan string {
+	r := reaction{}
+	r.RelatesTo.RelType = "m.annotation"
+	r.RelatesTo.EventID = eventID
+	r.RelatesTo.Key = key
+	done := make(chan string, 1)
+	c.outboundEvents <- outboundEvent{roomID, "m.reaction", r, true, done}
+	return done
+}
+
+// GetReaction returns the ID of the event the given m.reaction event is reacting to and the key of the reaction
+func GetReaction(event *gomatrix.Event) (eventID, key string, ok bool) {
+	relatesTo, ok := event.Content["m.relates_to"].(map[string]interface{})
+	if !ok {
+		return "", "", false
+	}
+	if relType, _ := relatesTo["rel_type"].(string); relType != "m.annotation" {
+		return "", "", false
+	}
+	eventID, _ = relatesTo["event_id"].(string)
+	key, _ = relatesTo["key"].(string)
+	return eventID, key, eventID != "" && key != ""
+}
@@ -0,0 +1,45 @@
+package matrix
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/matrix-org/gomatrix"
+)
+
+var formattedReplyFallback = regexp.MustCompile(`(?s)^<mx-reply>.*?</mx-reply>`)
+
+// GetReplyEventID returns the ID of the event the given event is replying to, or an empty string if it isn't a reply
+func GetReplyEventID(event *gomatrix.Event) string {
+	relatesTo, ok := event.Content["m.relates_to"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	inReplyTo, ok := relatesTo["m.in_reply_to"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	eventID, _ := inReplyTo["event_id"].(string)
+	return eventID
+}
+
+// StripReplyFallback removes the quoted reply fallback from the beginning of a plain text reply body
+func StripReplyFallback(body string) string {
+	if !strings.HasPrefix(body, "> ") {
+		return body
+	}
+	lines := strings.Split(body, "\n")
+	i := 0
+	for i < len(lines) && strings.HasPrefix(lines[i], "> ") {
+		i++
+	}
+	if i < len(lines) && lines[i] == "" {
+		i++
+	}
+	return strings.Join(lines[i:], "\n")
+}
+
+// StripFormattedReplyFallback removes the <mx-reply> reply fallback from the beginning of a html-formatted reply body
+func StripFormattedReplyFallback(formattedBody string) string {
+	return formattedReplyFallback.ReplaceAllString(formattedBody, "")
+}